@@ -2,11 +2,15 @@ package Lee
 
 import (
 	"html/template"
-	"log"
+	"log/slog"
 	"net/http"
+	"net/netip"
 	"path"
 	"strings"
 	"sync"
+	"time"
+
+	"github.com/lpz1208/Lee/Lee/codec"
 )
 
 type HandlerFunc func(*Context)
@@ -14,10 +18,25 @@ type HandlerFunc func(*Context)
 // Engine implement the interface of ServeHTTP
 type Engine struct {
 	*RouterGroup
-	router        *router
-	groups        []*RouterGroup     // store all groups
-	htmlTemplates *template.Template // for html render
-	funcMap       template.FuncMap   // for html render
+	router           *router
+	groups           []*RouterGroup   // store all groups
+	htmlRender       HTMLRender       // for html render
+	funcMap          template.FuncMap // for html render
+	cookieKeys       []cookieKey      // for signed and encrypted cookies
+	jsonCodec        codec.JSON       // for json render and binding
+	secureJSONPrefix string           // for SecureJSON
+	sseKeepAlive     time.Duration    // for Stream
+	logger           *slog.Logger     // for Logger and errors
+	server           serverState      // for Shutdown
+
+	// MaxMultipartMemory is the part of a multipart form kept in memory,
+	// the rest of the files is stored on disk. 32MB by default.
+	MaxMultipartMemory int64
+
+	// for ClientIP
+	trustedProxies  []netip.Prefix
+	trustedPlatform string
+	remoteIPHeaders []string
 	
 	// 性能优化：Context对象池
 	pool sync.Pool
@@ -27,11 +46,24 @@ type RouterGroup struct {
 	middlewares []HandlerFunc // support middleware
 	parent      *RouterGroup  // support nesting
 	engine      *Engine       // all groups share a Engine instance
+	bodyLimit   int64         // see SetBodyLimit
+	readTimeout time.Duration // see SetReadTimeout
+	layout      *string       // see SetLayout
 }
 
 // New is the constructor of gee.Engine
 func New() *Engine {
-	engine := &Engine{router: newRouter()}
+	engine := &Engine{
+		router:           newRouter(),
+		jsonCodec:        codec.StdJSON,
+		secureJSONPrefix: "while(1);",
+		sseKeepAlive:     15 * time.Second,
+
+		MaxMultipartMemory: 32 << 20,
+	}
+	if IsDebugging() {
+		engine.log().Warn("Lee: running in debug mode, set " + EnvLeeMode + "=" + ReleaseMode + " in production")
+	}
 	engine.RouterGroup = &RouterGroup{engine: engine}
 	engine.groups = []*RouterGroup{engine.RouterGroup}
 	
@@ -59,7 +91,9 @@ func (group *RouterGroup) Group(prefix string) *RouterGroup {
 }
 func (group *RouterGroup) addRoute(method string, comp string, handler HandlerFunc) {
 	pattern := group.prefix + comp
-	log.Printf("Route %4s - %s", method, pattern)
+	if IsDebugging() {
+		group.engine.log().Info("route", "method", method, "path", pattern)
+	}
 	group.engine.router.addRoute(method, pattern, handler)
 }
 
@@ -73,36 +107,69 @@ func (group *RouterGroup) POST(pattern string, handler HandlerFunc) {
 	group.addRoute("POST", pattern, handler)
 }
 
-// Run defines the method to start a http server
-func (engine *Engine) Run(addr string) (err error) {
-	return http.ListenAndServe(addr, engine)
-}
 func (group *RouterGroup) Use(middlewares ...HandlerFunc) {
 	group.middlewares = append(group.middlewares, middlewares...)
 }
 
-func (engine *Engine) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+// collect the middlewares of all groups matching the path, except those
+// of the groups matching a path in done, whose middlewares already ran
+func (engine *Engine) middlewares(path string, done ...string) []HandlerFunc {
 	var middlewares []HandlerFunc
+	limited := false
 	for _, group := range engine.groups {
-		if strings.HasPrefix(req.URL.Path, group.prefix) {
+		if group.matchesAny(done) {
+			limited = limited || group.hasLimits()
+			continue
+		}
+		if strings.HasPrefix(path, group.prefix) {
+			// limits apply before the middlewares of the first group setting
+			// one, but after those of the engine such as Logger and Recovery
+			root := group == engine.RouterGroup
+			if !limited && group.hasLimits() && !root {
+				middlewares = append(middlewares, applyGroupLimits)
+				limited = true
+			}
 			middlewares = append(middlewares, group.middlewares...)
+			if !limited && group.hasLimits() && root {
+				middlewares = append(middlewares, applyGroupLimits)
+				limited = true
+			}
 		}
 	}
+	return middlewares
+}
+
+func (group *RouterGroup) matchesAny(paths []string) bool {
+	for _, path := range paths {
+		if strings.HasPrefix(path, group.prefix) {
+			return true
+		}
+	}
+	return false
+}
 
+func (engine *Engine) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	// 从对象池获取Context对象
 	c := engine.pool.Get().(*Context)
 	
 	// 重置Context对象
-	c.Writer = w
+	c.writermem.reset(w)
+	c.Writer = &c.writermem
 	c.Req = req
 	c.Path = req.URL.Path
 	c.Method = req.Method
-	c.handlers = middlewares
+	c.handlers = engine.middlewares(c.Path)
 	c.engine = engine
 	c.index = -1
 	c.StatusCode = 0
-	c.headerWritten = false
 	c.Params = nil
+	c.fullPath = ""
+	c.Keys = nil
+	c.logger = nil
+	c.forwards = 0
+	c.routed = c.routed[:0]
+	c.formErr = nil
+	c.bodyTooLarge = false
 	
 	// 处理请求
 	engine.router.handle(c)
@@ -134,10 +201,24 @@ func (group *RouterGroup) Static(relativePath string, root string) {
 	// Register GET handlers
 	group.GET(urlPattern, handler)
 }
+// SetJSONCodec sets the JSON codec used for rendering and binding.
+func (engine *Engine) SetJSONCodec(jsonCodec codec.JSON) {
+	engine.jsonCodec = jsonCodec
+}
+
+// SetSecureJSONPrefix sets the prefix written by Context.SecureJSON,
+// "while(1);" by default.
+func (engine *Engine) SetSecureJSONPrefix(prefix string) {
+	engine.secureJSONPrefix = prefix
+}
+
+// SetFuncMap sets the funcs available to templates. Templates already
+// loaded are parsed again with them.
 func (engine *Engine) SetFuncMap(funcMap template.FuncMap) {
 	engine.funcMap = funcMap
+	engine.reloadFuncs()
 }
 
 func (engine *Engine) LoadHTMLGlob(pattern string) {
-	engine.htmlTemplates = template.Must(template.New("").Funcs(engine.funcMap).ParseGlob(pattern))
+	engine.loadHTML(&htmlSet{shared: &htmlSource{patterns: []string{pattern}}})
 }
@@ -0,0 +1,99 @@
+package Lee
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// BodyLimit is a middleware limiting request bodies to n bytes. Requests
+// declaring a larger Content-Length are rejected before anything is read,
+// the others fail with a 413 as soon as they read past the limit: reads
+// return a *http.MaxBytesError, and a 400 sent with Fail becomes a 413.
+func BodyLimit(n int64) HandlerFunc {
+	return func(c *Context) {
+		c.limitBody(n)
+	}
+}
+
+// SetBodyLimit limits request bodies of the group to n bytes, like
+// BodyLimit, but before any handler of the group runs, its middlewares
+// included. On the engine itself the limit applies after its middlewares,
+// so that rejected requests are still logged and recovered. The deepest
+// group with a limit wins, so a nested upload group may allow more than
+// its parent.
+func (group *RouterGroup) SetBodyLimit(n int64) {
+	group.bodyLimit = n
+}
+
+// SetReadTimeout limits the time to read the rest of the request of the
+// group. The deepest group with a timeout wins.
+func (group *RouterGroup) SetReadTimeout(d time.Duration) {
+	group.readTimeout = d
+}
+
+func (group *RouterGroup) hasLimits() bool {
+	return group.bodyLimit > 0 || group.readTimeout > 0
+}
+
+// applyGroupLimits runs before the middlewares of the outermost group
+// with limits, and applies the limits of the deepest one
+func applyGroupLimits(c *Context) {
+	var bodyLimit int64
+	var readTimeout time.Duration
+	limitPrefix, timeoutPrefix := -1, -1
+	for _, group := range c.engine.groups {
+		if !strings.HasPrefix(c.Path, group.prefix) {
+			continue
+		}
+		if group.bodyLimit > 0 && len(group.prefix) > limitPrefix {
+			bodyLimit, limitPrefix = group.bodyLimit, len(group.prefix)
+		}
+		if group.readTimeout > 0 && len(group.prefix) > timeoutPrefix {
+			readTimeout, timeoutPrefix = group.readTimeout, len(group.prefix)
+		}
+	}
+	if readTimeout > 0 {
+		http.NewResponseController(c.Writer).SetReadDeadline(time.Now().Add(readTimeout))
+	}
+	if bodyLimit > 0 {
+		c.limitBody(bodyLimit)
+		return
+	}
+	c.Next()
+}
+
+// limitBody runs the rest of the chain with the body limited to n bytes
+func (c *Context) limitBody(n int64) {
+	if c.Req.ContentLength > n {
+		c.Fail(http.StatusRequestEntityTooLarge, "request body too large")
+		return
+	}
+	if c.Req.Body == nil || c.Req.Body == http.NoBody {
+		c.Next()
+		return
+	}
+	c.Req.Body = &limitedBody{ReadCloser: http.MaxBytesReader(c.Writer, c.Req.Body, n), c: c}
+	c.Next()
+	// handlers that gave up on the body without answering
+	if c.bodyTooLarge && !c.Writer.Written() {
+		c.Fail(http.StatusRequestEntityTooLarge, "request body too large")
+	}
+}
+
+// limitedBody records on the context whether the limit was hit
+type limitedBody struct {
+	io.ReadCloser
+	c *Context
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	var maxErr *http.MaxBytesError
+	if err != nil && errors.As(err, &maxErr) {
+		b.c.bodyTooLarge = true
+	}
+	return n, err
+}
@@ -0,0 +1,32 @@
+package Lee
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+)
+
+// 性能优化：渲染缓冲区对象池
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// larger buffers are left to the GC instead of being pooled
+const maxPooledBuffer = 64 << 10
+
+// bufferedWriter collects the body written by a renderer, while headers
+// still go to the real ResponseWriter
+type bufferedWriter struct {
+	http.ResponseWriter
+	buf *bytes.Buffer
+}
+
+func (w *bufferedWriter) Write(b []byte) (int, error) {
+	return w.buf.Write(b)
+}
+
+// WriteHeader is a no-op, Context.Render writes the status once the
+// body is complete
+func (w *bufferedWriter) WriteHeader(int) {}
@@ -0,0 +1,195 @@
+package Lee
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Headers set by platforms which always put the client address in a
+// fixed header, for use with Engine.SetTrustedPlatform.
+const (
+	PlatformCloudflare      = "CF-Connecting-IP"
+	PlatformGoogleAppEngine = "X-Appengine-Remote-Addr"
+	PlatformFlyIO           = "Fly-Client-IP"
+	PlatformFastly          = "Fastly-Client-IP"
+	PlatformAkamai          = "True-Client-IP"
+)
+
+// defaultRemoteIPHeaders are checked in order by ClientIP
+var defaultRemoteIPHeaders = []string{"Forwarded", "X-Forwarded-For", "X-Real-IP"}
+
+// SetTrustedProxies sets the networks of the proxies whose forwarding
+// headers ClientIP believes. Entries may be CIDRs or single addresses.
+// No proxy is trusted by default.
+func (engine *Engine) SetTrustedProxies(cidrs []string) error {
+	prefixes := make([]netip.Prefix, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			addr, err := netip.ParseAddr(cidr)
+			if err != nil {
+				return err
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return err
+		}
+		if prefix.Addr().Is4In6() {
+			// the addresses compared are unmapped, so the prefix must be too
+			if prefix.Bits() < 96 {
+				return fmt.Errorf("Lee: IPv4-mapped prefix %s is shorter than /96", cidr)
+			}
+			prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	engine.trustedProxies = prefixes
+	return nil
+}
+
+// SetTrustedPlatform makes ClientIP return the address found in header,
+// such as PlatformCloudflare. Only use it when the application can be
+// reached through that platform alone, as clients can set any header.
+func (engine *Engine) SetTrustedPlatform(header string) {
+	engine.trustedPlatform = header
+}
+
+// SetRemoteIPHeaders sets the headers ClientIP reads behind trusted
+// proxies, in order. The default is Forwarded, X-Forwarded-For, X-Real-IP.
+func (engine *Engine) SetRemoteIPHeaders(headers ...string) {
+	engine.remoteIPHeaders = headers
+}
+
+func (engine *Engine) isTrustedProxy(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range engine.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// RemoteIP returns the address of the immediate peer of the connection.
+func (c *Context) RemoteIP() string {
+	addr, ok := remoteAddr(c.Req)
+	if !ok {
+		return ""
+	}
+	return addr.String()
+}
+
+func remoteAddr(req *http.Request) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(strings.TrimSpace(req.RemoteAddr))
+	if err != nil {
+		host = strings.TrimSpace(req.RemoteAddr)
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+// ClientIP returns the address of the client. Forwarding headers are only
+// honored when the immediate peer is a trusted proxy, and are read from
+// the right so that addresses added by untrusted hops are ignored.
+func (c *Context) ClientIP() string {
+	engine := c.engine
+	if engine.trustedPlatform != "" {
+		if addr, ok := parseForwardedAddr(c.Req.Header.Get(engine.trustedPlatform)); ok {
+			return addr.String()
+		}
+	}
+
+	remote, ok := remoteAddr(c.Req)
+	if !ok {
+		return ""
+	}
+	if !engine.isTrustedProxy(remote) {
+		return remote.String()
+	}
+
+	headers := engine.remoteIPHeaders
+	if headers == nil {
+		headers = defaultRemoteIPHeaders
+	}
+	for _, header := range headers {
+		values := c.Req.Header.Values(header)
+		if len(values) == 0 {
+			continue
+		}
+		var chain []string
+		if strings.EqualFold(header, "Forwarded") {
+			chain = forwardedFor(values)
+		} else {
+			for _, value := range values {
+				chain = append(chain, strings.Split(value, ",")...)
+			}
+		}
+		if addr, ok := engine.clientFromChain(chain); ok {
+			return addr.String()
+		}
+	}
+	return remote.String()
+}
+
+// clientFromChain walks a list of forwarded addresses from the nearest
+// hop and returns the first one that is not a trusted proxy
+func (engine *Engine) clientFromChain(chain []string) (netip.Addr, bool) {
+	var addr netip.Addr
+	for i := len(chain) - 1; i >= 0; i-- {
+		var ok bool
+		addr, ok = parseForwardedAddr(chain[i])
+		if !ok {
+			return netip.Addr{}, false
+		}
+		if !engine.isTrustedProxy(addr) {
+			return addr, true
+		}
+	}
+	// every hop is trusted, so the first one is the client
+	return addr, addr.IsValid()
+}
+
+// forwardedFor returns the for= parameters of RFC 7239 Forwarded headers
+func forwardedFor(values []string) []string {
+	var chain []string
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				key, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(key, "for") {
+					chain = append(chain, val)
+				}
+			}
+		}
+	}
+	return chain
+}
+
+// parseForwardedAddr parses addresses like 192.0.2.1, "192.0.2.1:80"
+// or "[2001:db8::1]:80", as found in forwarding headers
+func parseForwardedAddr(s string) (netip.Addr, bool) {
+	s = strings.Trim(strings.TrimSpace(s), `"`)
+	if s == "" {
+		return netip.Addr{}, false
+	}
+	if addr, err := netip.ParseAddr(s); err == nil {
+		return addr.Unmap(), true
+	}
+	if addrPort, err := netip.ParseAddrPort(s); err == nil {
+		return addrPort.Addr().Unmap(), true
+	}
+	if strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]") {
+		if addr, err := netip.ParseAddr(s[1 : len(s)-1]); err == nil {
+			return addr.Unmap(), true
+		}
+	}
+	return netip.Addr{}, false
+}
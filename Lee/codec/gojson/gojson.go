@@ -0,0 +1,37 @@
+// Package gojson provides a Lee JSON codec backed by github.com/goccy/go-json,
+// a faster drop-in replacement for encoding/json.
+//
+//	engine.SetJSONCodec(gojson.Codec)
+package gojson
+
+import (
+	"io"
+
+	"github.com/goccy/go-json"
+	"github.com/lpz1208/Lee/Lee/codec"
+)
+
+// Codec is the go-json codec.
+var Codec codec.JSON = goJSON{}
+
+type goJSON struct{}
+
+func (goJSON) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (goJSON) MarshalIndent(v interface{}, prefix, indent string) ([]byte, error) {
+	return json.MarshalIndent(v, prefix, indent)
+}
+
+func (goJSON) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (goJSON) NewEncoder(w io.Writer) codec.JSONEncoder {
+	return json.NewEncoder(w)
+}
+
+func (goJSON) NewDecoder(r io.Reader) codec.JSONDecoder {
+	return json.NewDecoder(r)
+}
@@ -0,0 +1,57 @@
+// Package codec defines the JSON codec Lee uses for rendering and binding,
+// so encoding/json can be swapped for a faster or custom implementation
+// with Engine.SetJSONCodec.
+package codec
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// JSON is implemented by JSON libraries usable by Lee.
+type JSON interface {
+	Marshal(v interface{}) ([]byte, error)
+	MarshalIndent(v interface{}, prefix, indent string) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+	NewEncoder(w io.Writer) JSONEncoder
+	NewDecoder(r io.Reader) JSONDecoder
+}
+
+// JSONEncoder writes JSON values to a stream, like json.Encoder.
+type JSONEncoder interface {
+	SetEscapeHTML(on bool)
+	SetIndent(prefix, indent string)
+	Encode(v interface{}) error
+}
+
+// JSONDecoder reads JSON values from a stream, like json.Decoder.
+type JSONDecoder interface {
+	UseNumber()
+	DisallowUnknownFields()
+	Decode(v interface{}) error
+}
+
+// StdJSON is the JSON codec backed by encoding/json, used by default.
+var StdJSON JSON = stdJSON{}
+
+type stdJSON struct{}
+
+func (stdJSON) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (stdJSON) MarshalIndent(v interface{}, prefix, indent string) ([]byte, error) {
+	return json.MarshalIndent(v, prefix, indent)
+}
+
+func (stdJSON) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (stdJSON) NewEncoder(w io.Writer) JSONEncoder {
+	return json.NewEncoder(w)
+}
+
+func (stdJSON) NewDecoder(r io.Reader) JSONDecoder {
+	return json.NewDecoder(r)
+}
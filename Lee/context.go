@@ -1,9 +1,18 @@
 package Lee
 
 import (
-	"encoding/json"
+	"bytes"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"sync"
+
+	"github.com/lpz1208/Lee/Lee/render"
+	"google.golang.org/protobuf/proto"
 )
 
 type H map[string]interface{}
@@ -22,43 +31,80 @@ type H map[string]interface{}
 //	}
 type Context struct {
 	// origin objects
-	Writer http.ResponseWriter
-	Req    *http.Request
+	Writer    ResponseWriter
+	Req       *http.Request
+	writermem responseWriter
 	// request info
-	Path   string
-	Method string
-	Params map[string]string
+	Path     string
+	Method   string
+	Params   map[string]string
+	fullPath string
+	// values shared between handlers of a request
+	Keys map[string]interface{}
 	// response info
 	StatusCode int
 	// middleware
-	handlers      []HandlerFunc
-	index         int
-	headerWritten bool
-	engine        *Engine
+	handlers []HandlerFunc
+	index    int
+	engine   *Engine
+	forwards int
+	routed   []string // paths routed before a Forward
+	formErr  error    // see FormError
+	logger   *slog.Logger
+	// set once a limited request body was read past its limit
+	bodyTooLarge bool
+	// serializes writes of Stream and its keep-alives
+	streamMu sync.Mutex
 }
 
+// maxForwards limits how often a single request can be forwarded
+const maxForwards = 10
+
 func newContext(w http.ResponseWriter, req *http.Request) *Context {
-	return &Context{
+	c := &Context{
 		Path:   req.URL.Path,
 		Method: req.Method,
 		Req:    req,
-		Writer: w,
 		index:  -1,
 	}
+	c.writermem.reset(w)
+	c.Writer = &c.writermem
+	return c
 }
 
 func (c *Context) Next() {
 	c.index++
-	s := len(c.handlers)
-	for ; c.index < s; c.index++ {
+	// handlers may be replaced by Forward, so re-check the length each time
+	for ; c.index < len(c.handlers); c.index++ {
 		c.handlers[c.index](c)
 	}
 }
+
+// FullPath returns the pattern of the matched route, such as
+// "/user/:id", or "" when no route matched.
+func (c *Context) FullPath() string {
+	return c.fullPath
+}
+
 func (c *Context) Param(key string) string {
 	value, _ := c.Params[key]
 	return value
 }
 
+// Set stores a value on the context for the rest of the request.
+func (c *Context) Set(key string, value interface{}) {
+	if c.Keys == nil {
+		c.Keys = make(map[string]interface{})
+	}
+	c.Keys[key] = value
+}
+
+// Get returns the value stored for key by Set.
+func (c *Context) Get(key string) (value interface{}, exists bool) {
+	value, exists = c.Keys[key]
+	return
+}
+
 //func newContext(w http.ResponseWriter, req *http.Request) *Context {
 //	return &Context{
 //		Writer: w,
@@ -68,7 +114,10 @@ func (c *Context) Param(key string) string {
 //	}
 //}
 
+// PostForm returns the form value of key, or "" when the form could not
+// be parsed, see FormError.
 func (c *Context) PostForm(key string) string {
+	c.parseMultipartForm()
 	return c.Req.FormValue(key)
 }
 
@@ -78,9 +127,8 @@ func (c *Context) Query(key string) string {
 
 func (c *Context) Status(code int) {
 	c.StatusCode = code
-	if !c.headerWritten {
+	if !c.Writer.Written() {
 		c.Writer.WriteHeader(code)
-		c.headerWritten = true
 	}
 }
 
@@ -88,34 +136,210 @@ func (c *Context) SetHeader(key string, value string) {
 	c.Writer.Header().Set(key, value)
 }
 
-func (c *Context) String(code int, format string, values ...interface{}) {
-	c.SetHeader("Content-Type", "text/plain")
+// Render writes the status code and the response body produced by r.
+// The body is rendered into a buffer first, so that nothing is sent
+// when rendering fails and a clean 500 can be returned instead.
+func (c *Context) Render(code int, r render.Render) {
+	if !bodyAllowedForStatus(code) {
+		r.WriteContentType(c.Writer)
+		c.Status(code)
+		return
+	}
+
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer func() {
+		if buf.Cap() <= maxPooledBuffer {
+			bufferPool.Put(buf)
+		}
+	}()
+
+	if err := r.Render(&bufferedWriter{ResponseWriter: c.Writer, buf: buf}); err != nil {
+		c.renderError(err)
+		return
+	}
+	header := c.Writer.Header()
+	if header.Get("Content-Length") == "" && header.Get("Transfer-Encoding") == "" {
+		header.Set("Content-Length", strconv.Itoa(buf.Len()))
+	}
 	c.Status(code)
-	c.Writer.Write([]byte(fmt.Sprintf(format, values...)))
+	c.Writer.Write(buf.Bytes())
+}
+
+// renderError replies with 500 if nothing has been sent yet
+func (c *Context) renderError(err error) {
+	c.index = len(c.handlers)
+	c.Logger().Error("render error", "error", err)
+	if c.Writer.Written() {
+		return
+	}
+	c.Writer.Header().Del("Content-Type")
+	c.Writer.Header().Del("Content-Length")
+	http.Error(c.Writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	c.StatusCode = http.StatusInternalServerError
+}
+
+// bodyAllowedForStatus reports whether a response with the given status
+// may have a body, see RFC 9110 section 6.4.1
+func bodyAllowedForStatus(status int) bool {
+	switch {
+	case status >= 100 && status <= 199:
+		return false
+	case status == http.StatusNoContent:
+		return false
+	case status == http.StatusNotModified:
+		return false
+	}
+	return true
+}
+
+func (c *Context) String(code int, format string, values ...interface{}) {
+	c.Render(code, render.String{Format: format, Data: values})
 }
 
 func (c *Context) JSON(code int, obj interface{}) {
-	c.SetHeader("Content-Type", "application/json")
-	c.Status(code)
-	encoder := json.NewEncoder(c.Writer)
-	if err := encoder.Encode(obj); err != nil {
-		http.Error(c.Writer, err.Error(), 500)
+	c.Render(code, render.JSON{Data: obj, Codec: c.engine.jsonCodec})
+}
+
+// IndentedJSON writes obj as indented JSON, which is meant for humans.
+func (c *Context) IndentedJSON(code int, obj interface{}) {
+	c.Render(code, render.IndentedJSON{Data: obj, Codec: c.engine.jsonCodec})
+}
+
+// PureJSON writes obj as JSON without escaping <, > and &.
+func (c *Context) PureJSON(code int, obj interface{}) {
+	c.Render(code, render.PureJSON{Data: obj, Codec: c.engine.jsonCodec})
+}
+
+// SecureJSON writes obj as JSON, prefixing arrays with the engine's
+// secure JSON prefix to prevent JSON hijacking.
+func (c *Context) SecureJSON(code int, obj interface{}) {
+	c.Render(code, render.SecureJSON{Prefix: c.engine.secureJSONPrefix, Data: obj, Codec: c.engine.jsonCodec})
+}
+
+// AsciiJSON writes obj as JSON with non-ASCII characters escaped.
+func (c *Context) AsciiJSON(code int, obj interface{}) {
+	c.Render(code, render.AsciiJSON{Data: obj, Codec: c.engine.jsonCodec})
+}
+
+// JSONP writes obj wrapped in the function named by the callback query
+// parameter, or as plain JSON when there is none. Callbacks which are
+// not safe identifiers are rejected with 400.
+func (c *Context) JSONP(code int, obj interface{}) {
+	callback := c.Query("callback")
+	if callback == "" {
+		c.JSON(code, obj)
+		return
 	}
+	if !render.ValidCallback(callback) {
+		c.Fail(http.StatusBadRequest, "invalid JSONP callback")
+		return
+	}
+	c.Render(code, render.JSONP{Callback: callback, Data: obj, Codec: c.engine.jsonCodec})
+}
+
+// BindJSON decodes the JSON request body into obj with the engine's
+// JSON codec.
+func (c *Context) BindJSON(obj interface{}) error {
+	if c.Req.Body == nil {
+		return errors.New("Lee: missing request body")
+	}
+	return c.engine.jsonCodec.NewDecoder(c.Req.Body).Decode(obj)
+}
+
+// XML writes obj encoded as XML.
+func (c *Context) XML(code int, obj interface{}) {
+	c.Render(code, render.XML{Data: obj})
+}
+
+// YAML writes obj encoded as YAML.
+func (c *Context) YAML(code int, obj interface{}) {
+	c.Render(code, render.YAML{Data: obj})
+}
+
+// TOML writes obj encoded as TOML.
+func (c *Context) TOML(code int, obj interface{}) {
+	c.Render(code, render.TOML{Data: obj})
+}
+
+// MsgPack writes obj encoded as MessagePack.
+func (c *Context) MsgPack(code int, obj interface{}) {
+	c.Render(code, render.MsgPack{Data: obj})
+}
+
+// ProtoBuf writes msg in the protocol buffers wire format.
+func (c *Context) ProtoBuf(code int, msg proto.Message) {
+	c.Render(code, render.ProtoBuf{Data: msg})
 }
 
 func (c *Context) Data(code int, data []byte) {
-	c.Status(code)
-	c.Writer.Write(data)
+	c.Render(code, render.Data{Data: data})
 }
 
 func (c *Context) Fail(code int, err string) {
 	c.index = len(c.handlers)
+	// a bad request caused by an oversized body is reported as such
+	if c.bodyTooLarge && code == http.StatusBadRequest {
+		code, err = http.StatusRequestEntityTooLarge, "request body too large"
+	}
 	c.JSON(code, H{"message": err})
 }
+
+// HTML renders the template name, inside the layout of the group if one
+// is set.
 func (c *Context) HTML(code int, name string, data interface{}) {
-	c.SetHeader("Content-Type", "text/html")
-	c.Status(code)
-	if err := c.engine.htmlTemplates.ExecuteTemplate(c.Writer, name, data); err != nil {
-		c.Fail(500, err.Error())
+	c.HTMLLayout(code, c.layout(), name, data)
+}
+
+// Redirect replies to the request with a redirect to location,
+// which may be a path relative to the current request path.
+func (c *Context) Redirect(code int, location string) {
+	if code < http.StatusMultipleChoices || code > http.StatusPermanentRedirect ||
+		code == http.StatusNotModified || code == 306 {
+		panic(fmt.Sprintf("Lee: cannot redirect with status code %d", code))
+	}
+	c.StatusCode = code
+	if !c.Writer.Written() {
+		// http.Redirect resolves relative locations against c.Req.URL.Path
+		http.Redirect(c.Writer, c.Req, location, code)
 	}
 }
+
+// Forward routes the request again as if it had been made for path,
+// without a round trip to the client. The remaining handlers of the
+// current chain are skipped, and the middlewares which already ran, such
+// as those of the engine, do not run again.
+func (c *Context) Forward(location string) {
+	if c.forwards >= maxForwards {
+		c.Fail(http.StatusInternalServerError, "too many forwards")
+		return
+	}
+	u, err := url.Parse(location)
+	if err != nil || u.IsAbs() {
+		c.Fail(http.StatusInternalServerError, fmt.Sprintf("invalid forward location %q", location))
+		return
+	}
+	if u.Path == "" {
+		u.Path = c.Path
+	} else if u.Path[0] != '/' {
+		u.Path = path.Join(path.Dir(c.Path), u.Path)
+	}
+
+	req := c.Req.Clone(c.Req.Context())
+	req.URL.Path = u.Path
+	req.URL.RawPath = ""
+	if u.RawQuery != "" {
+		req.URL.RawQuery = u.RawQuery
+	}
+	req.RequestURI = req.URL.RequestURI()
+
+	c.forwards++
+	c.routed = append(c.routed, c.Path)
+	c.logger = nil
+	c.Req = req
+	c.Path = req.URL.Path
+	c.Params = nil
+	c.handlers = c.engine.middlewares(c.Path, c.routed...)
+	c.index = -1
+	c.engine.router.handle(c)
+}
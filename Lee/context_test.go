@@ -0,0 +1,1428 @@
+package Lee
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"log/slog"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/lpz1208/Lee/Lee/codec/gojson"
+	"github.com/lpz1208/Lee/Lee/render"
+	"github.com/lpz1208/Lee/Lee/websocket"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestRedirect(t *testing.T) {
+	r := New()
+	r.GET("/docs/old", func(c *Context) {
+		c.Redirect(http.StatusMovedPermanently, "new?page=2")
+		if c.StatusCode != http.StatusMovedPermanently || c.Writer.Status() != http.StatusMovedPermanently {
+			t.Errorf("context state not updated: status %d, written %d", c.StatusCode, c.Writer.Status())
+		}
+	})
+	r.GET("/bad", func(c *Context) {
+		defer func() {
+			if recover() == nil {
+				t.Error("redirect with status 200 should panic")
+			}
+		}()
+		c.Redirect(http.StatusOK, "/")
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/docs/old", nil))
+	if w.Code != http.StatusMovedPermanently {
+		t.Fatalf("expected 301, got %d", w.Code)
+	}
+	if loc := w.Header().Get("Location"); loc != "/docs/new?page=2" {
+		t.Fatalf("relative location resolved to %q", loc)
+	}
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/bad", nil))
+}
+
+func TestForward(t *testing.T) {
+	r := New()
+	runs := 0
+	// like Sessions, it replaces the state each time it runs
+	r.Use(func(c *Context) {
+		runs++
+		c.Set("state", H{})
+		c.Next()
+	})
+	v1 := r.Group("/v1")
+	v1.Use(func(c *Context) {
+		c.SetHeader("X-Group", "v1")
+		c.Next()
+	})
+	v1.GET("/users/:id", func(c *Context) {
+		state, _ := c.Get("state")
+		c.String(http.StatusOK, "user %s %s %v", c.Param("id"), c.Query("full"), state.(H)["user"])
+	})
+	r.GET("/me", func(c *Context) {
+		state, _ := c.Get("state")
+		state.(H)["user"] = "lee"
+		c.Forward("/v1/users/42?full=yes")
+	})
+	r.GET("/loop", func(c *Context) {
+		c.Forward("/loop")
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/me", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "user 42 yes lee" {
+		t.Fatalf("unexpected forward response %d %q", w.Code, w.Body.String())
+	}
+	if w.Header().Get("X-Group") != "v1" {
+		t.Fatal("middlewares of the target group should run")
+	}
+	if runs != 1 {
+		t.Fatalf("engine middleware ran %d times", runs)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/loop", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("forward loop should fail, got %d", w.Code)
+	}
+}
+
+func TestSignedAndEncryptedCookies(t *testing.T) {
+	oldKey := []byte("0123456789abcdef-old")
+	newKey := []byte("0123456789abcdef-new")
+
+	r := New()
+	r.SetCookieKeys(oldKey)
+	r.GET("/set", func(c *Context) {
+		c.SetSignedCookie("user", "alice", CookieOptions{HttpOnly: true})
+		c.SetEncryptedCookie("secret", "s3cr3t", CookieOptions{Partitioned: true})
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/set", nil))
+	cookies := w.Result().Cookies()
+	if len(cookies) != 2 {
+		t.Fatalf("expected 2 cookies, got %d", len(cookies))
+	}
+	if !cookies[1].Secure || !cookies[1].Partitioned {
+		t.Fatal("partitioned cookies must be secure")
+	}
+
+	// rotate keys, cookies issued with the old key must still verify
+	r.SetCookieKeys(newKey, oldKey)
+	r.GET("/get", func(c *Context) {
+		user, err := c.SignedCookie("user")
+		if err != nil || user != "alice" {
+			t.Errorf("signed cookie: %q, %v", user, err)
+		}
+		secret, err := c.EncryptedCookie("secret")
+		if err != nil || secret != "s3cr3t" {
+			t.Errorf("encrypted cookie: %q, %v", secret, err)
+		}
+	})
+	req := httptest.NewRequest("GET", "/get", nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	// tampered or moved values are rejected
+	r.GET("/tampered", func(c *Context) {
+		if _, err := c.SignedCookie("user"); err != ErrInvalidCookie {
+			t.Errorf("tampered signed cookie: %v", err)
+		}
+		if _, err := c.EncryptedCookie("other"); err != ErrInvalidCookie {
+			t.Errorf("renamed encrypted cookie: %v", err)
+		}
+	})
+	req = httptest.NewRequest("GET", "/tampered", nil)
+	req.AddCookie(&http.Cookie{Name: "user", Value: "Ym9i." + cookies[0].Value[len("YWxpY2U."):]})
+	req.AddCookie(&http.Cookie{Name: "other", Value: cookies[1].Value})
+	r.ServeHTTP(httptest.NewRecorder(), req)
+}
+
+func TestClientIP(t *testing.T) {
+	r := New()
+	if err := r.SetTrustedProxies([]string{"::ffff:0:0/80"}); err == nil {
+		t.Fatal("IPv4-mapped prefix shorter than /96 accepted")
+	}
+	if err := r.SetTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1"}); err != nil {
+		t.Fatal(err)
+	}
+	var got string
+	r.GET("/", func(c *Context) { got = c.ClientIP() })
+
+	tests := []struct {
+		remote string
+		header string
+		value  string
+		want   string
+	}{
+		{"203.0.113.9:1234", "X-Forwarded-For", "1.2.3.4", "203.0.113.9"},
+		{"10.0.0.1:1234", "X-Forwarded-For", "1.2.3.4, 198.51.100.7, 10.1.1.1", "198.51.100.7"},
+		{"10.0.0.1:1234", "X-Forwarded-For", "10.2.2.2, 10.1.1.1", "10.2.2.2"},
+		{"192.168.1.1:1234", "X-Real-IP", "1.2.3.4", "1.2.3.4"},
+		{"10.0.0.1:1234", "Forwarded", `for=192.0.2.60;proto=http, for="[2001:db8::1]:4711"`, "2001:db8::1"},
+		{"10.0.0.1:1234", "X-Forwarded-For", "garbage", "10.0.0.1"},
+		{"[::ffff:10.0.0.1]:1234", "X-Forwarded-For", "1.2.3.4", "1.2.3.4"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = tt.remote
+		req.Header.Set(tt.header, tt.value)
+		r.ServeHTTP(httptest.NewRecorder(), req)
+		if got != tt.want {
+			t.Errorf("%s %s: %s, got %s, want %s", tt.remote, tt.header, tt.value, got, tt.want)
+		}
+	}
+
+	r.SetTrustedPlatform(PlatformCloudflare)
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("CF-Connecting-IP", "198.51.100.1")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	if got != "198.51.100.1" {
+		t.Errorf("platform header ignored, got %s", got)
+	}
+}
+
+// csvRender is a renderer defined outside the render package
+type csvRender struct{ rows [][]string }
+
+func (r csvRender) Render(w http.ResponseWriter) error {
+	r.WriteContentType(w)
+	for _, row := range r.rows {
+		if _, err := w.Write([]byte(strings.Join(row, ",") + "\n")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r csvRender) WriteContentType(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/csv")
+}
+
+func TestRenderers(t *testing.T) {
+	type point struct {
+		X int `json:"x" xml:"x" yaml:"x" toml:"x" codec:"x"`
+	}
+	r := New()
+	r.GET("/xml", func(c *Context) { c.XML(http.StatusOK, point{1}) })
+	r.GET("/yaml", func(c *Context) { c.YAML(http.StatusOK, point{1}) })
+	r.GET("/toml", func(c *Context) { c.TOML(http.StatusOK, point{1}) })
+	r.GET("/msgpack", func(c *Context) { c.MsgPack(http.StatusOK, point{1}) })
+	r.GET("/protobuf", func(c *Context) { c.ProtoBuf(http.StatusOK, wrapperspb.String("lee")) })
+	r.GET("/csv", func(c *Context) { c.Render(http.StatusOK, csvRender{[][]string{{"a", "b"}}}) })
+	r.GET("/empty", func(c *Context) { c.JSON(http.StatusNoContent, H{"ignored": true}) })
+
+	pb, _ := proto.Marshal(wrapperspb.String("lee"))
+	tests := []struct {
+		path        string
+		contentType string
+		body        string
+	}{
+		{"/xml", "application/xml; charset=utf-8", "<point><x>1</x></point>"},
+		{"/yaml", "application/yaml; charset=utf-8", "x: 1\n"},
+		{"/toml", "application/toml; charset=utf-8", "x = 1\n"},
+		{"/msgpack", "application/msgpack", "\x81\xa1x\x01"},
+		{"/protobuf", "application/x-protobuf", string(pb)},
+		{"/csv", "text/csv", "a,b\n"},
+		{"/empty", "application/json", ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		if ct := w.Header().Get("Content-Type"); ct != tt.contentType {
+			t.Errorf("%s: content type %q", tt.path, ct)
+		}
+		if w.Body.String() != tt.body {
+			t.Errorf("%s: body %q, want %q", tt.path, w.Body.String(), tt.body)
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	r := New()
+	r.GET("/", func(c *Context) {
+		c.Negotiate(http.StatusOK, Negotiate{
+			Offered: []string{MIMEJSON, MIMEXML, MIMEYAML, MIMEPlain, MIMEXML2},
+			Data:    H{"name": "lee"},
+			XMLData: struct {
+				Name string `xml:"name"`
+			}{"lee"},
+		})
+	})
+
+	tests := []struct {
+		accept string
+		code   int
+		ctype  string
+		body   string
+	}{
+		{"", http.StatusOK, "application/json", `{"name":"lee"}` + "\n"},
+		{"application/xml", http.StatusOK, "application/xml; charset=utf-8", "<response><name>lee</name></response>"},
+		{"text/xml", http.StatusOK, "text/xml; charset=utf-8", "<response><name>lee</name></response>"},
+		{"text/html;q=0.9, application/yaml;q=0.8, */*;q=0.1", http.StatusOK, "application/yaml; charset=utf-8", "name: lee\n"},
+		{"application/*;q=0.5, application/json;q=0", http.StatusOK, "application/xml; charset=utf-8", "<response><name>lee</name></response>"},
+		{"*/*", http.StatusOK, "application/json", `{"name":"lee"}` + "\n"},
+		{"text/plain, application/json;q=0.5", http.StatusOK, "text/plain", "map[name:lee]"},
+		{"text/html", http.StatusNotAcceptable, "application/json", ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		if tt.accept != "" {
+			req.Header.Set("Accept", tt.accept)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.code || w.Header().Get("Content-Type") != tt.ctype {
+			t.Errorf("Accept %q: got %d %q", tt.accept, w.Code, w.Header().Get("Content-Type"))
+		}
+		if tt.body != "" && w.Body.String() != tt.body {
+			t.Errorf("Accept %q: body %q, want %q", tt.accept, w.Body.String(), tt.body)
+		}
+		if w.Header().Get("Vary") != "Accept" {
+			t.Errorf("Accept %q: missing Vary header", tt.accept)
+		}
+	}
+}
+
+func TestJSONVariants(t *testing.T) {
+	r := New()
+	data := H{"html": "<b>é😀</b>"}
+	r.GET("/json", func(c *Context) { c.JSON(http.StatusOK, data) })
+	r.GET("/indented", func(c *Context) { c.IndentedJSON(http.StatusOK, H{"a": 1}) })
+	r.GET("/pure", func(c *Context) { c.PureJSON(http.StatusOK, data) })
+	r.GET("/secure", func(c *Context) { c.SecureJSON(http.StatusOK, []int{1, 2}) })
+	r.GET("/ascii", func(c *Context) { c.AsciiJSON(http.StatusOK, data) })
+	r.GET("/jsonp", func(c *Context) { c.JSONP(http.StatusOK, H{"a": 1}) })
+
+	tests := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/json", 200, `{"html":"\u003cb\u003eé😀\u003c/b\u003e"}` + "\n"},
+		{"/indented", 200, "{\n    \"a\": 1\n}"},
+		{"/pure", 200, `{"html":"<b>é😀</b>"}` + "\n"},
+		{"/secure", 200, "while(1);[1,2]"},
+		{"/ascii", 200, `{"html":"\u003cb\u003e\u00e9\ud83d\ude00\u003c/b\u003e"}`},
+		{"/jsonp?callback=app.cb", 200, `/**/app.cb({"a":1});`},
+		{"/jsonp?callback=alert(1)//", 400, `{"message":"invalid JSONP callback"}` + "\n"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		if w.Code != tt.code || w.Body.String() != tt.body {
+			t.Errorf("%s: got %d %q, want %q", tt.path, w.Code, w.Body.String(), tt.body)
+		}
+	}
+}
+
+func TestJSONCodec(t *testing.T) {
+	r := New()
+	r.SetJSONCodec(gojson.Codec)
+	r.POST("/echo", func(c *Context) {
+		var body struct {
+			Name string `json:"name"`
+		}
+		if err := c.BindJSON(&body); err != nil {
+			c.Fail(http.StatusBadRequest, err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, H{"name": body.Name})
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/echo", strings.NewReader(`{"name":"lee"}`)))
+	if w.Code != http.StatusOK || w.Body.String() != `{"name":"lee"}`+"\n" {
+		t.Fatalf("got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestRenderErrorIsClean500(t *testing.T) {
+	r := New()
+	r.htmlRender = &htmlSet{tree: newHTMLTree(template.Must(template.New("page").Parse(`<p>partial</p>{{index .Items 3}}`)))}
+	r.GET("/json", func(c *Context) { c.JSON(http.StatusOK, H{"ch": make(chan int)}) })
+	r.GET("/html", func(c *Context) { c.HTML(http.StatusOK, "page", H{}) })
+
+	for _, path := range []string{"/json", "/html"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusInternalServerError {
+			t.Errorf("%s: expected 500, got %d", path, w.Code)
+		}
+		if strings.Contains(w.Body.String(), "partial") || w.Header().Get("Content-Type") != "text/plain; charset=utf-8" {
+			t.Errorf("%s: partial response leaked: %q %q", path, w.Header().Get("Content-Type"), w.Body.String())
+		}
+	}
+}
+
+func TestResponseWriterTracking(t *testing.T) {
+	r := New()
+	var status, size int
+	r.Use(func(c *Context) {
+		c.Next()
+		status, size = c.Writer.Status(), c.Writer.Size()
+	})
+	r.Static("/assets", "../static")
+	r.GET("/raw", func(c *Context) {
+		c.Writer.WriteHeader(http.StatusAccepted)
+		c.Writer.Write([]byte("raw"))
+	})
+	r.GET("/flush", func(c *Context) {
+		c.Writer.Write([]byte("a"))
+		if err := http.NewResponseController(c.Writer).Flush(); err != nil {
+			t.Errorf("flush through ResponseController: %v", err)
+		}
+		if _, err := io.Copy(c.Writer, strings.NewReader("bc")); err != nil {
+			t.Error(err)
+		}
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/raw", nil))
+	if status != http.StatusAccepted || size != 3 {
+		t.Errorf("direct writes: status %d, size %d", status, size)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/assets/css/geektutu.css", nil))
+	if status != http.StatusOK || size != w.Body.Len() || size == 0 {
+		t.Errorf("file server: status %d, size %d, body %d", status, size, w.Body.Len())
+	}
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/assets/missing.css", nil))
+	if status != http.StatusNotFound {
+		t.Errorf("missing file: status %d", status)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/flush", nil))
+	if !w.Flushed || w.Body.String() != "abc" || size != 3 {
+		t.Errorf("flush: flushed %v, body %q, size %d", w.Flushed, w.Body.String(), size)
+	}
+}
+
+func TestResponseWriterHijack(t *testing.T) {
+	r := New()
+	r.GET("/hijack", func(c *Context) {
+		conn, rw, err := c.Writer.Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 2\r\nConnection: close\r\n\r\nok")
+		rw.Flush()
+		if !c.Writer.Written() {
+			t.Error("hijacked writer should count as written")
+		}
+	})
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "/hijack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "ok" {
+		t.Fatalf("unexpected body %q", body)
+	}
+}
+
+func TestUpgrade(t *testing.T) {
+	r := New()
+	status := make(chan int, 1)
+	r.Use(func(c *Context) {
+		c.Next()
+		status <- c.Writer.Status()
+	})
+	r.GET("/ws", func(c *Context) {
+		c.Writer.Header().Set("X-Room", "lobby")
+		conn, err := c.Upgrade(nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		conn.WriteMessage(websocket.TextMessage, append([]byte("echo: "), msg...))
+	})
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
+	conn, resp, err := websocket.Dial(context.Background(), url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if resp.Header.Get("X-Room") != "lobby" {
+		t.Fatal("headers set before the upgrade were not sent")
+	}
+	conn.WriteMessage(websocket.TextMessage, []byte("hi"))
+	if _, msg, err := conn.ReadMessage(); err != nil || string(msg) != "echo: hi" {
+		t.Fatalf("unexpected reply %q: %v", msg, err)
+	}
+	if s := <-status; s != http.StatusSwitchingProtocols {
+		t.Fatalf("logged status %d", s)
+	}
+
+	// plain requests get an error response
+	plain, err := http.Get(srv.URL + "/ws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain.Body.Close()
+	if plain.StatusCode != http.StatusBadRequest {
+		t.Fatalf("plain request got %d", plain.StatusCode)
+	}
+}
+
+func TestFileServing(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "data.txt")
+	if err := os.WriteFile(name, []byte("0123456789"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r := New()
+	r.GET("/file", func(c *Context) { c.File(name) })
+	r.GET("/download", func(c *Context) { c.FileAttachment(name, "résumé \"final\".txt") })
+	r.GET("/fs/*name", func(c *Context) { c.FileFromFS(c.Param("name"), http.Dir(dir)) })
+	r.GET("/reader", func(c *Context) {
+		c.DataFromReader(http.StatusOK, 10, "text/plain", strings.NewReader("0123456789"),
+			map[string]string{"ETag": `"v1"`})
+	})
+	r.GET("/stream", func(c *Context) {
+		c.DataFromReader(http.StatusOK, 10, "text/plain", io.LimitReader(strings.NewReader("0123456789"), 10), nil)
+	})
+
+	get := func(path string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/file")
+	if w.Code != 200 || w.Body.String() != "0123456789" || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		t.Fatalf("file: %d %q", w.Code, w.Body.String())
+	}
+	etag, lastModified := w.Header().Get("ETag"), w.Header().Get("Last-Modified")
+	if w := get("/file", "If-None-Match", etag); w.Code != http.StatusNotModified {
+		t.Fatalf("If-None-Match: %d", w.Code)
+	}
+	if w := get("/file", "If-Modified-Since", lastModified); w.Code != http.StatusNotModified {
+		t.Fatalf("If-Modified-Since: %d", w.Code)
+	}
+	w = get("/file", "Range", "bytes=4-", "If-Range", etag)
+	if w.Code != http.StatusPartialContent || w.Body.String() != "456789" || w.Header().Get("Content-Range") != "bytes 4-9/10" {
+		t.Fatalf("range: %d %q", w.Code, w.Body.String())
+	}
+
+	w = get("/download")
+	want := `attachment; filename="r_sum_ \"final\".txt"; filename*=UTF-8''r%C3%A9sum%C3%A9%20%22final%22.txt`
+	if got := w.Header().Get("Content-Disposition"); got != want {
+		t.Fatalf("disposition %s", got)
+	}
+
+	if w := get("/fs/data.txt", "Range", "bytes=0-1"); w.Body.String() != "01" {
+		t.Fatalf("fs range: %q", w.Body.String())
+	}
+	if w := get("/fs/../" + filepath.Base(dir) + "/data.txt"); w.Code != http.StatusNotFound {
+		t.Fatalf("fs traversal: %d", w.Code)
+	}
+	if w := get("/fs/missing.txt"); w.Code != http.StatusNotFound {
+		t.Fatalf("missing file: %d", w.Code)
+	}
+
+	if w := get("/reader", "Range", "bytes=-3"); w.Code != http.StatusPartialContent || w.Body.String() != "789" {
+		t.Fatalf("reader range: %d %q", w.Code, w.Body.String())
+	}
+	if w := get("/reader", "If-None-Match", `"v1"`); w.Code != http.StatusNotModified {
+		t.Fatalf("reader If-None-Match: %d", w.Code)
+	}
+	if w := get("/stream", "Range", "bytes=4-"); w.Code != 200 || w.Body.String() != "0123456789" {
+		t.Fatalf("stream: %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestMultipartUpload(t *testing.T) {
+	dir := t.TempDir()
+	r := New()
+	r.MaxMultipartMemory = 16
+	r.POST("/upload", func(c *Context) {
+		fh, err := c.FormFile("file")
+		if err != nil {
+			c.Fail(http.StatusBadRequest, err.Error())
+			return
+		}
+		if err := c.SaveUploadedFile(fh, dir+"/"); err != nil {
+			c.Fail(http.StatusBadRequest, err.Error())
+			return
+		}
+		if err := c.SaveUploadedFile(fh, dir+"/../escaped.txt"); err != ErrInvalidFilename {
+			t.Errorf("traversal: %v", err)
+		}
+		form, _ := c.MultipartForm()
+		c.String(http.StatusOK, "%s %s %d", c.PostForm("title"), fh.Filename, len(form.File["file"]))
+	})
+	r.POST("/stream", func(c *Context) {
+		mr, err := c.MultipartReader()
+		if err != nil {
+			c.Fail(http.StatusBadRequest, err.Error())
+			return
+		}
+		var total int64
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				c.Fail(http.StatusBadRequest, err.Error())
+				return
+			}
+			n, _ := io.Copy(io.Discard, part)
+			total += n
+		}
+		c.String(http.StatusOK, "%d", total)
+	})
+	r.POST("/form", func(c *Context) {
+		title := c.PostForm("title")
+		if err := c.FormError(); err != nil {
+			c.Fail(http.StatusBadRequest, err.Error())
+			return
+		}
+		c.String(http.StatusOK, "%s", title)
+	})
+
+	// a broken body is not mistaken for a missing field
+	req := httptest.NewRequest("POST", "/form", strings.NewReader("--x\r\nbroken"))
+	req.Header.Set("Content-Type", "multipart/form-data; boundary=x")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("broken form: %d %s", w.Code, w.Body.String())
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("title", "report")
+	fw, _ := mw.CreateFormFile("file", `..\..\evil.txt`)
+	fw.Write([]byte("uploaded contents larger than sixteen bytes"))
+	mw.Close()
+	for _, path := range []string{"/upload", "/stream"} {
+		req := httptest.NewRequest("POST", path, bytes.NewReader(body.Bytes()))
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: %d %s", path, w.Code, w.Body.String())
+		}
+		if path == "/upload" && w.Body.String() != `report ..\..\evil.txt 1` {
+			t.Fatalf("upload: %q", w.Body.String())
+		}
+		if path == "/stream" && w.Body.String() != "49" {
+			t.Fatalf("stream: %q", w.Body.String())
+		}
+	}
+	saved, err := os.ReadFile(filepath.Join(dir, "evil.txt"))
+	if err != nil || string(saved) != "uploaded contents larger than sixteen bytes" {
+		t.Fatalf("saved file: %q %v", saved, err)
+	}
+}
+
+func TestBodyLimit(t *testing.T) {
+	r := New()
+	readBody := func(c *Context) {
+		body, err := io.ReadAll(c.Req.Body)
+		if err != nil {
+			return
+		}
+		c.String(http.StatusOK, "%d", len(body))
+	}
+	api := r.Group("/api")
+	api.SetBodyLimit(8)
+	api.POST("/echo", readBody)
+	uploads := api.Group("/uploads")
+	uploads.SetBodyLimit(1 << 10)
+	uploads.POST("/file", readBody)
+	// the limit also covers the middlewares of the group
+	signed := r.Group("/signed")
+	signed.SetBodyLimit(8)
+	signed.Use(func(c *Context) {
+		if _, err := io.ReadAll(c.Req.Body); err != nil {
+			c.Fail(http.StatusBadRequest, "unreadable body")
+			return
+		}
+		c.Next()
+	})
+	signed.POST("/hook", func(c *Context) { c.String(http.StatusOK, "ok") })
+	small := r.Group("/small")
+	small.Use(BodyLimit(4))
+	small.POST("/json", func(c *Context) {
+		var v interface{}
+		if err := c.BindJSON(&v); err != nil {
+			c.Fail(http.StatusBadRequest, "invalid json")
+			return
+		}
+		c.JSON(http.StatusOK, v)
+	})
+	// other errors are left alone
+	small.POST("/auth", func(c *Context) {
+		io.ReadAll(c.Req.Body)
+		c.Fail(http.StatusUnauthorized, "unauthorized")
+	})
+
+	post := func(path string, body io.Reader) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, body)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	tests := []struct {
+		path string
+		body io.Reader
+		code int
+	}{
+		{"/api/echo", strings.NewReader("12345678"), http.StatusOK},
+		{"/api/echo", strings.NewReader("123456789"), http.StatusRequestEntityTooLarge},
+		// no Content-Length, the limit is hit while reading
+		{"/api/echo", io.MultiReader(strings.NewReader("123456789")), http.StatusRequestEntityTooLarge},
+		{"/api/uploads/file", strings.NewReader(strings.Repeat("x", 100)), http.StatusOK},
+		{"/signed/hook", strings.NewReader("12345678"), http.StatusOK},
+		{"/signed/hook", strings.NewReader("123456789"), http.StatusRequestEntityTooLarge},
+		{"/signed/hook", io.MultiReader(strings.NewReader("123456789")), http.StatusRequestEntityTooLarge},
+		{"/small/json", io.MultiReader(strings.NewReader(`"12345"`)), http.StatusRequestEntityTooLarge},
+		{"/small/json", strings.NewReader(`"12345"`), http.StatusRequestEntityTooLarge},
+		{"/small/auth", io.MultiReader(strings.NewReader("12345")), http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		if w := post(tt.path, tt.body); w.Code != tt.code {
+			t.Fatalf("%s: %d %s", tt.path, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestEngineBodyLimit(t *testing.T) {
+	r := New()
+	var logged []int
+	r.Use(func(c *Context) {
+		c.Next()
+		logged = append(logged, c.Writer.Status())
+	}, Recovery())
+	r.SetBodyLimit(4)
+	r.POST("/panic", func(c *Context) { panic("boom") })
+
+	for _, tt := range []struct {
+		body string
+		code int
+	}{
+		{"12345", http.StatusRequestEntityTooLarge},
+		{"1234", http.StatusInternalServerError},
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("POST", "/panic", strings.NewReader(tt.body)))
+		if w.Code != tt.code {
+			t.Fatalf("%q: got %d", tt.body, w.Code)
+		}
+	}
+	if len(logged) != 2 || logged[0] != http.StatusRequestEntityTooLarge {
+		t.Fatalf("engine middlewares did not see the requests: %v", logged)
+	}
+}
+
+func TestReadTimeout(t *testing.T) {
+	r := New()
+	readErr := make(chan error, 1)
+	slow := r.Group("/slow")
+	slow.SetReadTimeout(50 * time.Millisecond)
+	slow.POST("/upload", func(c *Context) {
+		_, err := io.ReadAll(c.Req.Body)
+		readErr <- err
+	})
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	io.WriteString(conn, "POST /slow/upload HTTP/1.1\r\nHost: test\r\nContent-Length: 100\r\n\r\npartial")
+	select {
+	case err := <-readErr:
+		if err == nil {
+			t.Fatal("stalled body should time out")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("read timeout was not applied")
+	}
+}
+
+func TestModes(t *testing.T) {
+	defer SetMode(Mode())
+	dir := t.TempDir()
+	page := filepath.Join(dir, "page.tmpl")
+	os.WriteFile(page, []byte(`{{define "page"}}v1{{end}}`), 0o644)
+
+	newEngine := func() *Engine {
+		r := New()
+		r.Use(Recovery())
+		r.LoadHTMLGlob(filepath.Join(dir, "*.tmpl"))
+		r.GET("/user/:id", func(c *Context) { c.String(http.StatusOK, c.FullPath()) })
+		r.GET("/page", func(c *Context) { c.HTML(http.StatusOK, "page", nil) })
+		r.GET("/panic", func(c *Context) { panic("secret detail") })
+		return r
+	}
+	get := func(r *Engine, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	SetMode(ReleaseMode)
+	release := newEngine()
+	SetMode(DebugMode)
+	debug := newEngine()
+
+	w := get(debug, "/user/42")
+	if w.Body.String() != "/user/:id" || w.Header().Get("X-Lee-Route") != "GET-/user/:id" {
+		t.Fatalf("debug route trace: %q %q", w.Body.String(), w.Header().Get("X-Lee-Route"))
+	}
+	if w := get(debug, "/panic"); w.Code != 500 || !strings.Contains(w.Body.String(), "secret detail") {
+		t.Fatalf("debug panic: %d %s", w.Code, w.Body.String())
+	}
+	os.WriteFile(page, []byte(`{{define "page"}}v2{{end}}`), 0o644)
+	if w := get(debug, "/page"); w.Body.String() != "v2" {
+		t.Fatalf("debug templates should reload, got %q", w.Body.String())
+	}
+
+	SetMode(ReleaseMode)
+	if w := get(release, "/user/42"); w.Header().Get("X-Lee-Route") != "" {
+		t.Fatal("release mode must not expose routes")
+	}
+	if w := get(release, "/panic"); w.Code != 500 || strings.Contains(w.Body.String(), "secret") {
+		t.Fatalf("release panic: %d %s", w.Code, w.Body.String())
+	}
+	if w := get(release, "/page"); w.Body.String() != "v1" {
+		t.Fatalf("release templates are parsed once, got %q", w.Body.String())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("unknown modes should panic")
+		}
+	}()
+	SetMode("verbose")
+}
+
+func TestHTMLTemplates(t *testing.T) {
+	defer SetMode(Mode())
+	SetMode(ReleaseMode)
+	render := func(r *Engine, name string) string {
+		r.GET("/"+name, func(c *Context) { c.HTML(http.StatusOK, name, H{"Name": "lee"}) })
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/"+name, nil))
+		return w.Body.String()
+	}
+
+	fsys := fstest.MapFS{
+		"views/hello.tmpl":   {Data: []byte(`hello {{.Name}}`)},
+		"partials/base.tmpl": {Data: []byte(`<h1>{{block "title" .}}untitled{{end}}</h1>`)},
+		"pages/index.tmpl":   {Data: []byte(`{{define "title"}}index{{end}}{{template "base.tmpl" .}}`)},
+		"pages/about.tmpl":   {Data: []byte(`{{define "title"}}about {{.Name}}{{end}}{{template "base.tmpl" .}}`)},
+	}
+	r := New()
+	r.LoadHTMLFS(fsys, "views/*.tmpl")
+	if got := render(r, "hello.tmpl"); got != "hello lee" {
+		t.Fatalf("LoadHTMLFS: %q", got)
+	}
+
+	// both pages define "title" in their own tree
+	r = New()
+	r.LoadHTMLPages(fsys, "pages/*.tmpl", "partials/*.tmpl")
+	if got := render(r, "index.tmpl"); got != "<h1>index</h1>" {
+		t.Fatalf("index page: %q", got)
+	}
+	if got := render(r, "about.tmpl"); got != "<h1>about lee</h1>" {
+		t.Fatalf("about page: %q", got)
+	}
+	func() {
+		defer func() {
+			if err := recover(); err == nil || !strings.Contains(fmt.Sprint(err), `both named "index.tmpl"`) {
+				t.Errorf("duplicate page names: %v", err)
+			}
+		}()
+		New().LoadHTMLPages(fstest.MapFS{
+			"admin/index.tmpl": {Data: []byte(`admin`)},
+			"shop/index.tmpl":  {Data: []byte(`shop`)},
+		}, "*/index.tmpl")
+	}()
+
+	// files are re-parsed on change in debug mode, and their names are
+	// not glob patterns
+	SetMode(DebugMode)
+	dir := filepath.Join(t.TempDir(), "[v]*")
+	os.Mkdir(dir, 0o755)
+	file := filepath.Join(dir, "page.tmpl")
+	os.WriteFile(file, []byte(`v1`), 0o644)
+	r = New()
+	r.LoadHTMLFiles(file)
+	if got := render(r, "page.tmpl"); got != "v1" {
+		t.Fatalf("LoadHTMLFiles: %q", got)
+	}
+	os.WriteFile(file, []byte(`v2 {{.Name}}`), 0o644)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(file, later, later)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/page.tmpl", nil))
+	if w.Body.String() != "v2 lee" {
+		t.Fatalf("changed template: %q", w.Body.String())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("patterns matching nothing should panic")
+		}
+	}()
+	New().LoadHTMLFS(fsys, "missing/*.tmpl")
+}
+
+func TestHTMLLayouts(t *testing.T) {
+	fsys := fstest.MapFS{
+		"layouts/base.tmpl":   {Data: []byte(`<main>{{template "content" .}}</main>{{partial "footer.tmpl" .}}`)},
+		"layouts/admin.tmpl":  {Data: []byte(`<admin>{{yield .}}</admin>`)},
+		"views/students.tmpl": {Data: []byte(`students of {{upper .Name}}`)},
+		"views/footer.tmpl":   {Data: []byte(`<footer>{{.Name}}</footer>`)},
+	}
+	r := New()
+	r.SetFuncMap(template.FuncMap{"upper": strings.ToUpper})
+	r.LoadHTMLFS(fsys, "layouts/*.tmpl", "views/*.tmpl")
+	r.SetLayout("base.tmpl")
+	students := func(c *Context) { c.HTML(http.StatusOK, "students.tmpl", H{"Name": "lee"}) }
+	r.GET("/students", students)
+	admin := r.Group("/admin")
+	admin.SetLayout("admin.tmpl")
+	admin.GET("/students", students)
+	raw := admin.Group("/raw")
+	raw.SetLayout("")
+	raw.GET("/students", students)
+	r.GET("/override", func(c *Context) { c.HTMLLayout(http.StatusOK, "admin.tmpl", "students.tmpl", H{"Name": "x"}) })
+	r.GET("/missing", func(c *Context) { c.HTMLLayout(http.StatusOK, "nope.tmpl", "students.tmpl", nil) })
+
+	tests := []struct {
+		path, body string
+	}{
+		{"/students", "<main>students of LEE</main><footer>lee</footer>"},
+		{"/admin/students", "<admin>students of LEE</admin>"},
+		{"/admin/raw/students", "students of LEE"},
+		{"/override", "<admin>students of X</admin>"},
+		// views are cached, render twice
+		{"/students", "<main>students of LEE</main><footer>lee</footer>"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		if w.Body.String() != tt.body {
+			t.Fatalf("%s: %q", tt.path, w.Body.String())
+		}
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/missing", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("missing layout: %d", w.Code)
+	}
+}
+
+type stubHTMLRender struct{}
+
+func (stubHTMLRender) Instance(layout, name string, data interface{}) (render.Render, error) {
+	return render.String{Format: "%s in %s", Data: []interface{}{name, layout}}, nil
+}
+
+func TestHTMLRenderAndFuncs(t *testing.T) {
+	get := func(r *Engine) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		return w
+	}
+	page := func(c *Context) { c.HTML(http.StatusOK, "page.tmpl", "lee") }
+
+	// rendering before loading templates is an error, not a panic
+	r := New()
+	r.GET("/", page)
+	if w := get(r); w.Code != http.StatusInternalServerError {
+		t.Fatalf("no templates: %d", w.Code)
+	}
+
+	fsys := fstest.MapFS{"page.tmpl": {Data: []byte(`{{greet .}}{{shout "!"}}`)}}
+	r.SetFuncMap(template.FuncMap{"greet": func(s string) string { return "hi " + s }})
+	r.AddFunc("shout", func(s string) string { return s })
+	r.LoadHTMLFS(fsys, "*.tmpl")
+	if w := get(r); w.Body.String() != "hi lee!" {
+		t.Fatalf("funcs before loading: %q", w.Body.String())
+	}
+	// funcs set after loading replace the old ones
+	r.SetFuncMap(template.FuncMap{
+		"greet": func(s string) string { return "hello " + s },
+		"shout": func(s string) string { return s },
+	})
+	r.AddFunc("shout", func(s string) string { return s + s })
+	if w := get(r); w.Body.String() != "hello lee!!" {
+		t.Fatalf("funcs after loading: %q", w.Body.String())
+	}
+
+	r.SetHTMLRender(stubHTMLRender{})
+	r.SetLayout("base")
+	if w := get(r); w.Body.String() != "page.tmpl in base" {
+		t.Fatalf("custom HTMLRender: %q", w.Body.String())
+	}
+}
+
+// funcsHTMLRender renders the names of the funcs it was given
+type funcsHTMLRender struct{ funcs template.FuncMap }
+
+func (r *funcsHTMLRender) SetFuncMap(funcs template.FuncMap) { r.funcs = funcs }
+
+func (r *funcsHTMLRender) Instance(layout, name string, data interface{}) (render.Render, error) {
+	return render.String{Format: "%d funcs", Data: []interface{}{len(r.funcs)}}, nil
+}
+
+func TestHTMLFuncsAfterLoading(t *testing.T) {
+	get := func(r *Engine) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		return w
+	}
+	defer SetMode(Mode())
+	SetMode(ReleaseMode)
+	var out bytes.Buffer
+	r := New()
+	r.SetLogger(slog.New(slog.NewTextHandler(&out, nil)))
+	r.GET("/", func(c *Context) { c.HTML(http.StatusOK, "page.tmpl", "lee") })
+	fsys := fstest.MapFS{"page.tmpl": {Data: []byte(`{{greet .}}{{shout "!"}}`)}}
+	r.LoadHTMLFS(fsys, "*.tmpl")
+	if !strings.Contains(out.String(), `function \"greet\" not defined`) {
+		t.Fatalf("missing funcs are not logged: %s", out.String())
+	}
+	// the failed parse is kept, not retried on every request
+	fsys["page.tmpl"] = &fstest.MapFile{Data: []byte(`fixed`)}
+	if w := get(r); w.Code != http.StatusInternalServerError {
+		t.Fatalf("missing funcs: %d %q", w.Code, w.Body.String())
+	}
+	fsys["page.tmpl"] = &fstest.MapFile{Data: []byte(`{{greet .}}{{shout "!"}}`)}
+	r.AddFunc("greet", func(s string) string { return "hi " + s })
+	if w := get(r); w.Code != http.StatusInternalServerError {
+		t.Fatalf("one missing func: %d %q", w.Code, w.Body.String())
+	}
+	r.AddFunc("shout", func(s string) string { return s })
+	if w := get(r); w.Code != http.StatusOK || w.Body.String() != "hi lee!" {
+		t.Fatalf("funcs added after loading: %d %q", w.Code, w.Body.String())
+	}
+
+	// other renderers get the funcs when they accept them
+	custom := &funcsHTMLRender{}
+	r.SetHTMLRender(custom)
+	r.AddFunc("upper", strings.ToUpper)
+	if w := get(r); w.Body.String() != "3 funcs" {
+		t.Fatalf("custom HTMLFuncRender: %q", w.Body.String())
+	}
+
+	// other parse errors still stop loading
+	defer func() {
+		if recover() == nil {
+			t.Fatal("syntax error did not panic")
+		}
+	}()
+	r.LoadHTMLFS(fstest.MapFS{"bad.tmpl": {Data: []byte(`{{define "a"}}{{.X}`)}}, "*.tmpl")
+}
+
+func TestStructuredLogging(t *testing.T) {
+	var out bytes.Buffer
+	r := New()
+	r.SetLogger(slog.New(slog.NewJSONHandler(&out, nil)))
+	r.Use(Logger(), Recovery())
+	r.GET("/user/:id", func(c *Context) {
+		c.Logger().Info("loading user", "id", c.Param("id"))
+		c.String(http.StatusOK, "ok")
+	})
+	r.GET("/panic", func(c *Context) { panic("boom") })
+
+	req := httptest.NewRequest("GET", "/user/7", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.Header.Set("X-Request-ID", "req-1")
+	req.Header.Set("User-Agent", "test-agent")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/panic", nil))
+
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("invalid log line %q", line)
+		}
+		records = append(records, record)
+	}
+	if len(records) != 4 {
+		t.Fatalf("expected 4 records, got %d: %s", len(records), out.String())
+	}
+	want := map[string]interface{}{
+		"msg": "loading user", "id": "7", "method": "GET", "path": "/user/7", "route": "/user/:id",
+		"client_ip": "192.0.2.1", "request_id": "req-1", "user_agent": "test-agent",
+	}
+	for key, value := range want {
+		if records[0][key] != value {
+			t.Errorf("handler log %s = %v, want %v", key, records[0][key], value)
+		}
+	}
+	if records[1]["msg"] != "request" || records[1]["status"] != float64(200) || records[1]["bytes"] != float64(2) ||
+		records[1]["request_id"] != "req-1" || records[1]["latency"] == nil {
+		t.Errorf("request log: %v", records[1])
+	}
+	if records[2]["msg"] != "panic recovered" || records[2]["level"] != "ERROR" || records[2]["route"] != "/panic" {
+		t.Errorf("panic log: %v", records[2])
+	}
+	if records[3]["status"] != float64(500) || records[3]["level"] != "ERROR" {
+		t.Errorf("failed request log: %v", records[3])
+	}
+}
+
+func TestLoggerFormats(t *testing.T) {
+	serve := func(config LoggerConfig, target string) string {
+		var out bytes.Buffer
+		config.Output = &out
+		r := New()
+		r.Use(LoggerWithConfig(config))
+		r.GET("/user/:id", func(c *Context) { c.String(http.StatusCreated, "hello") })
+		r.GET("/healthz", func(c *Context) { c.Status(http.StatusOK) })
+		req := httptest.NewRequest("GET", target, nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		req.Header.Set("User-Agent", "test-agent")
+		req.Header.Set("Referer", "http://example.com/")
+		req.SetBasicAuth("frank", "secret")
+		r.ServeHTTP(httptest.NewRecorder(), req)
+		return out.String()
+	}
+
+	line := serve(LoggerConfig{Format: LogFormatCommon}, "/user/7?x=1")
+	if !strings.HasPrefix(line, "192.0.2.1 - frank [") || !strings.HasSuffix(line, `] "GET /user/7?x=1 HTTP/1.1" 201 5`+"\n") {
+		t.Errorf("common: %q", line)
+	}
+	// a client cannot add fields to the line
+	hostile := commonLogFormatter(LogFormatterParams{
+		Request: httptest.NewRequest("GET", "/", nil), ClientIP: "192.0.2.1", User: "john doe\"\n",
+		Method: "GET", Path: `/a" 200 1 "x`, Status: 200,
+	})
+	if !strings.HasPrefix(hostile, `192.0.2.1 - john\x20doe\"\x0a [`) || !strings.Contains(hostile, `"GET /a\" 200 1 \"x HTTP/1.1" 200 -`) {
+		t.Errorf("hostile common: %q", hostile)
+	}
+	line = serve(LoggerConfig{Format: LogFormatCombined}, "/user/7")
+	if !strings.HasSuffix(line, `201 5 "http://example.com/" "test-agent"`+"\n") {
+		t.Errorf("combined: %q", line)
+	}
+	var record map[string]interface{}
+	line = serve(LoggerConfig{Format: LogFormatJSON}, "/user/7")
+	if err := json.Unmarshal([]byte(line), &record); err != nil {
+		t.Fatalf("json: %q", line)
+	}
+	if record["route"] != "/user/:id" || record["status"] != float64(201) || record["bytes"] != float64(5) || record["client_ip"] != "192.0.2.1" {
+		t.Errorf("json: %v", record)
+	}
+	line = serve(LoggerConfig{Format: LogFormatLogfmt}, "/user/7")
+	if !strings.Contains(line, " method=GET path=/user/7 route=/user/:id status=201 ") || !strings.Contains(line, "user_agent=test-agent") {
+		t.Errorf("logfmt: %q", line)
+	}
+
+	custom := func(p LogFormatterParams) string { return p.Method + " " + p.Route }
+	if line = serve(LoggerConfig{Formatter: custom, Format: LogFormatJSON}, "/user/7"); line != "GET /user/:id\n" {
+		t.Errorf("custom: %q", line)
+	}
+	// colors are only used on terminals
+	if line = serve(LoggerConfig{Format: LogFormatLogfmt, Color: true}, "/user/7"); strings.Contains(line, "\033[") {
+		t.Errorf("colored output to a buffer: %q", line)
+	}
+	colored := logfmtFormatter(LogFormatterParams{Method: "GET", Status: 201, Color: true})
+	if !strings.Contains(colored, "method=\033[34mGET\033[0m status=\033[32m201\033[0m") || strings.Contains(colored, `\x1b`) {
+		t.Errorf("colored logfmt: %q", colored)
+	}
+	if line = serve(LoggerConfig{Format: LogFormatCommon, SkipPaths: []string{"/healthz"}}, "/healthz"); line != "" {
+		t.Errorf("skipped path logged: %q", line)
+	}
+	skipOK := func(c *Context) bool { return c.Writer.Status() < 400 }
+	if line = serve(LoggerConfig{Format: LogFormatCommon, Skip: skipOK}, "/user/7"); line != "" {
+		t.Errorf("skipped request logged: %q", line)
+	}
+	if line = serve(LoggerConfig{Format: LogFormatCommon, Skip: skipOK}, "/missing"); !strings.Contains(line, `" 404 `) {
+		t.Errorf("not found: %q", line)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("unknown format did not panic")
+		}
+	}()
+	LoggerWithConfig(LoggerConfig{Format: "apache"})
+}
+
+func TestRecoveryWithConfig(t *testing.T) {
+	var out bytes.Buffer
+	var handled []any
+	r := New()
+	r.Use(RecoveryWithConfig(RecoveryConfig{
+		Output:      &out,
+		DumpRequest: true,
+		Handler: func(c *Context, err any) {
+			handled = append(handled, err)
+			c.String(http.StatusServiceUnavailable, "sorry")
+		},
+	}))
+	r.GET("/panic", func(c *Context) { panic("boom") })
+	r.GET("/written", func(c *Context) {
+		c.String(http.StatusOK, "partial")
+		panic("late")
+	})
+	r.GET("/pipe", func(c *Context) {
+		panic(&net.OpError{Op: "write", Net: "tcp", Err: os.NewSyscallError("write", syscall.EPIPE)})
+	})
+	r.GET("/abort", func(c *Context) { panic(http.ErrAbortHandler) })
+	r.GET("/count", func(c *Context) { panic(42) })
+
+	req := httptest.NewRequest("GET", "/panic", nil)
+	req.Header.Set("Authorization", "Bearer secret-token")
+	req.Header.Set("X-Trace", "visible")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusServiceUnavailable || w.Body.String() != "sorry" || len(handled) != 1 || handled[0] != "boom" {
+		t.Errorf("custom handler: %d %q %v", w.Code, w.Body.String(), handled)
+	}
+	log := out.String()
+	if !strings.Contains(log, "panic recovered: boom") || !strings.Contains(log, "Authorization: [REDACTED]") ||
+		!strings.Contains(log, "X-Trace: visible") || strings.Contains(log, "secret-token") || !strings.Contains(log, "Traceback:") {
+		t.Errorf("output: %s", log)
+	}
+
+	// a started response is left alone
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/written", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "partial" || len(handled) != 1 {
+		t.Errorf("written: %d %q %v", w.Code, w.Body.String(), handled)
+	}
+	// nothing is written to a client that went away
+	out.Reset()
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/pipe", nil))
+	if w.Body.Len() != 0 || len(handled) != 1 || strings.Contains(out.String(), "Traceback:") {
+		t.Errorf("broken pipe: %q %v %s", w.Body.String(), handled, out.String())
+	}
+	// panic values which are not errors are formatted as they are
+	out.Reset()
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/count", nil))
+	if !strings.Contains(out.String(), "panic recovered: 42\n") {
+		t.Errorf("non-error panic: %s", out.String())
+	}
+
+	func() {
+		defer func() {
+			if err := recover(); err != http.ErrAbortHandler {
+				t.Errorf("ErrAbortHandler not passed on: %v", err)
+			}
+		}()
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/abort", nil))
+	}()
+}
+
+func TestPanicPage(t *testing.T) {
+	defer SetMode(Mode())
+	SetMode(DebugMode)
+	r := New()
+	r.Use(Recovery())
+	r.GET("/user/:id", func(c *Context) {
+		c.Set("account", "acme")
+		panic(fmt.Errorf("load user %s: %w", c.Param("id"), fs.ErrNotExist)) // the panicking line
+	})
+	// built at run time, as the page shows the source of this test
+	token := strings.ToUpper("secret-token")
+	get := func(accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/user/7?tab=1", nil)
+		req.Header.Set("Accept", accept)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("text/html")
+	body := w.Body.String()
+	if w.Code != 500 || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("html page: %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	for _, want := range []string{
+		"panic: load user 7: file does not exist", "*errors.errorString: file does not exist",
+		"TestPanicPage", "// the panicking line", "/user/:id", "/user/7?tab=1", "acme", "[REDACTED]",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("html page misses %q", want)
+		}
+	}
+	if strings.Contains(body, token) {
+		t.Error("html page shows the Authorization header")
+	}
+
+	var report panicReport
+	w = get("application/json")
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatalf("json page: %v %s", err, w.Body.String())
+	}
+	if report.Route != "/user/:id" || report.Params["id"] != "7" || report.Keys["account"] != "acme" ||
+		len(report.Causes) != 1 || report.Request.Headers["Authorization"][0] != "[REDACTED]" {
+		t.Errorf("json page: %+v", report)
+	}
+	if len(report.Frames) == 0 || !strings.Contains(report.Frames[0].Function, "TestPanicPage") {
+		t.Fatalf("first frame: %+v", report.Frames)
+	}
+	var current string
+	for _, line := range report.Frames[0].Source {
+		if line.Current {
+			current = line.Code
+		}
+	}
+	if !strings.Contains(current, "// the panicking line") || len(report.Frames[0].Source) != 2*sourceContext+1 {
+		t.Errorf("source of the first frame: %+v", report.Frames[0].Source)
+	}
+
+	// the headers configured for redaction are hidden on the page too
+	r = New()
+	r.Use(RecoveryWithConfig(RecoveryConfig{Output: io.Discard, RedactHeaders: []string{"X-Api-Key"}}))
+	r.GET("/user/:id", func(c *Context) { panic("boom") })
+	req := httptest.NewRequest("GET", "/user/7", nil)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("X-Api-Key", token)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if strings.Contains(w.Body.String(), token) || !strings.Contains(w.Body.String(), `"X-Api-Key":["[REDACTED]"]`) {
+		t.Errorf("custom redaction: %s", w.Body.String())
+	}
+
+	// panic values which are not errors are formatted as they are
+	r.GET("/count", func(c *Context) { panic(42) })
+	req = httptest.NewRequest("GET", "/count", nil)
+	req.Header.Set("Accept", "application/json")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	report = panicReport{}
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil || report.Error != "42" {
+		t.Errorf("non-error panic: %v %s", err, w.Body.String())
+	}
+}
+
+func TestSSEventLineBreaks(t *testing.T) {
+	r := New()
+	r.GET("/", func(c *Context) {
+		c.SSEventWithID("1\r\nretry: 1", "message\revent: evil", "hello\revent: evil\rdata: injected\r\nend\nlast")
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	want := "id: 1 retry: 1\nevent: message event: evil\n" +
+		"data: hello\ndata: event: evil\ndata: data: injected\ndata: end\ndata: last\n\n"
+	if w.Body.String() != want {
+		t.Fatalf("got %q", w.Body.String())
+	}
+}
+
+func TestStreamSSE(t *testing.T) {
+	r := New()
+	r.SetSSEKeepAlive(10 * time.Millisecond)
+	messages := make(chan string)
+	clientGone := make(chan bool, 1)
+	r.GET("/events", func(c *Context) {
+		if c.LastEventID() != "7" {
+			t.Errorf("Last-Event-ID: %q", c.LastEventID())
+		}
+		clientGone <- c.Stream(func(w io.Writer) bool {
+			select {
+			case msg := <-messages:
+				c.SSEventWithID("8", "message", H{"text": msg})
+				return true
+			case <-c.Req.Context().Done():
+				return true
+			}
+		})
+	})
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL+"/events", nil)
+	req.Header.Set("Last-Event-ID", "7")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("content type %q", ct)
+	}
+	reader := bufio.NewReader(resp.Body)
+	readEvent := func() string {
+		var lines []string
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			if line == "\n" {
+				return strings.Join(lines, "")
+			}
+			lines = append(lines, line)
+		}
+	}
+
+	if ev := readEvent(); ev != ": keep-alive\n" {
+		t.Fatalf("expected keep-alive, got %q", ev)
+	}
+	messages <- "hi"
+	for {
+		ev := readEvent()
+		if ev == ": keep-alive\n" {
+			continue
+		}
+		if ev != "id: 8\nevent: message\ndata: {\"text\":\"hi\"}\n" {
+			t.Fatalf("unexpected event %q", ev)
+		}
+		break
+	}
+
+	cancel()
+	resp.Body.Close()
+	select {
+	case gone := <-clientGone:
+		if !gone {
+			t.Fatal("Stream should report the client disconnect")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Stream did not stop after the client disconnected")
+	}
+}
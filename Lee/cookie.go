@@ -0,0 +1,195 @@
+package Lee
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var (
+	// ErrNoCookieKeys is returned by the signed and encrypted cookie helpers
+	// when Engine.SetCookieKeys has not been called.
+	ErrNoCookieKeys = errors.New("Lee: no cookie keys configured")
+	// ErrInvalidCookie is returned when a cookie fails verification or decryption.
+	ErrInvalidCookie = errors.New("Lee: invalid cookie")
+)
+
+// CookieOptions holds the attributes of a cookie set by SetCookie.
+// An empty Path defaults to "/".
+type CookieOptions struct {
+	Path        string
+	Domain      string
+	MaxAge      int
+	SameSite    http.SameSite
+	Secure      bool
+	HttpOnly    bool
+	Partitioned bool
+}
+
+// cookieKey holds the keys derived from one secret passed to SetCookieKeys
+type cookieKey struct {
+	sign []byte
+	aead cipher.AEAD
+}
+
+func deriveKey(secret []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// SetCookieKeys configures the secrets used for signed and encrypted cookies.
+// The first key signs and encrypts new cookies, all keys are tried when
+// reading, so old keys can be kept around while rotating.
+func (engine *Engine) SetCookieKeys(secrets ...[]byte) {
+	keys := make([]cookieKey, 0, len(secrets))
+	for _, secret := range secrets {
+		if len(secret) < 16 {
+			panic("Lee: cookie keys must be at least 16 bytes")
+		}
+		block, err := aes.NewCipher(deriveKey(secret, "Lee encrypted cookie"))
+		if err != nil {
+			panic(err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			panic(err)
+		}
+		keys = append(keys, cookieKey{sign: deriveKey(secret, "Lee signed cookie"), aead: aead})
+	}
+	engine.cookieKeys = keys
+}
+
+// Cookie returns the unescaped value of the named request cookie,
+// or http.ErrNoCookie if it is not present.
+func (c *Context) Cookie(name string) (string, error) {
+	cookie, err := c.Req.Cookie(name)
+	if err != nil {
+		return "", err
+	}
+	return url.QueryUnescape(cookie.Value)
+}
+
+// SetCookie adds a Set-Cookie header to the response.
+func (c *Context) SetCookie(name, value string, opts CookieOptions) {
+	if opts.Path == "" {
+		opts.Path = "/"
+	}
+	// browsers reject SameSite=None and partitioned cookies without Secure
+	if opts.SameSite == http.SameSiteNoneMode || opts.Partitioned {
+		opts.Secure = true
+	}
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:        name,
+		Value:       url.QueryEscape(value),
+		Path:        opts.Path,
+		Domain:      opts.Domain,
+		MaxAge:      opts.MaxAge,
+		SameSite:    opts.SameSite,
+		Secure:      opts.Secure,
+		HttpOnly:    opts.HttpOnly,
+		Partitioned: opts.Partitioned,
+	})
+}
+
+func signCookie(key []byte, name, payload string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(name))
+	mac.Write([]byte{'|'})
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// SetSignedCookie sets a cookie whose value is readable by the client
+// but protected against tampering with an HMAC.
+func (c *Context) SetSignedCookie(name, value string, opts CookieOptions) error {
+	keys := c.engine.cookieKeys
+	if len(keys) == 0 {
+		return ErrNoCookieKeys
+	}
+	payload := base64.RawURLEncoding.EncodeToString([]byte(value))
+	sig := base64.RawURLEncoding.EncodeToString(signCookie(keys[0].sign, name, payload))
+	c.SetCookie(name, payload+"."+sig, opts)
+	return nil
+}
+
+// SignedCookie returns the value of a cookie set by SetSignedCookie.
+func (c *Context) SignedCookie(name string) (string, error) {
+	keys := c.engine.cookieKeys
+	if len(keys) == 0 {
+		return "", ErrNoCookieKeys
+	}
+	raw, err := c.Cookie(name)
+	if err != nil {
+		return "", err
+	}
+	payload, encodedSig, ok := strings.Cut(raw, ".")
+	if !ok {
+		return "", ErrInvalidCookie
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(encodedSig)
+	if err != nil {
+		return "", ErrInvalidCookie
+	}
+	for _, key := range keys {
+		if hmac.Equal(sig, signCookie(key.sign, name, payload)) {
+			value, err := base64.RawURLEncoding.DecodeString(payload)
+			if err != nil {
+				return "", ErrInvalidCookie
+			}
+			return string(value), nil
+		}
+	}
+	return "", ErrInvalidCookie
+}
+
+// SetEncryptedCookie sets a cookie whose value is encrypted and
+// authenticated with AES-GCM, so the client can neither read nor change it.
+func (c *Context) SetEncryptedCookie(name, value string, opts CookieOptions) error {
+	keys := c.engine.cookieKeys
+	if len(keys) == 0 {
+		return ErrNoCookieKeys
+	}
+	aead := keys[0].aead
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(value)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	// the cookie name is authenticated so values can't be moved between cookies
+	sealed := aead.Seal(nonce, nonce, []byte(value), []byte(name))
+	c.SetCookie(name, base64.RawURLEncoding.EncodeToString(sealed), opts)
+	return nil
+}
+
+// EncryptedCookie returns the value of a cookie set by SetEncryptedCookie.
+func (c *Context) EncryptedCookie(name string) (string, error) {
+	keys := c.engine.cookieKeys
+	if len(keys) == 0 {
+		return "", ErrNoCookieKeys
+	}
+	raw, err := c.Cookie(name)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return "", ErrInvalidCookie
+	}
+	for _, key := range keys {
+		n := key.aead.NonceSize()
+		if len(sealed) < n {
+			return "", ErrInvalidCookie
+		}
+		if value, err := key.aead.Open(nil, sealed[:n], sealed[n:], []byte(name)); err == nil {
+			return string(value), nil
+		}
+	}
+	return "", ErrInvalidCookie
+}
@@ -0,0 +1,177 @@
+package Lee
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// File writes the named file. Range, If-Modified-Since and If-None-Match
+// are honoured, so downloads can resume. The path is used as is and must
+// not come from the request; use FileFromFS for that.
+func (c *Context) File(filepath string) {
+	f, err := os.Open(filepath)
+	if err != nil {
+		c.fileError(err)
+		return
+	}
+	defer f.Close()
+	c.serveFile(f, filepath)
+}
+
+// FileAttachment writes the named file as a download saved under name.
+func (c *Context) FileAttachment(filepath, name string) {
+	c.SetHeader("Content-Disposition", attachmentDisposition(name))
+	c.File(filepath)
+}
+
+// FileFromFS writes the file at name from fs. Names are resolved inside
+// fs, so it is safe to use with request input.
+func (c *Context) FileFromFS(name string, fs http.FileSystem) {
+	f, err := fs.Open(name)
+	if err != nil {
+		c.fileError(err)
+		return
+	}
+	defer f.Close()
+	c.serveFile(f, name)
+}
+
+// DataFromReader writes length bytes read from reader, with headers added
+// to the response. A negative length streams the body without
+// Content-Length. With status 200, conditional requests are answered
+// using the ETag and Last-Modified headers, and Range is supported when
+// reader is an io.ReadSeeker.
+func (c *Context) DataFromReader(code int, length int64, contentType string, reader io.Reader, headers map[string]string) {
+	header := c.Writer.Header()
+	for key, value := range headers {
+		header.Set(key, value)
+	}
+	header.Set("Content-Type", contentType)
+
+	if code == http.StatusOK && length >= 0 {
+		var modtime time.Time
+		if lm := header.Get("Last-Modified"); lm != "" {
+			modtime, _ = http.ParseTime(lm)
+		}
+		req := c.Req
+		content, ok := reader.(io.ReadSeeker)
+		if !ok {
+			// without seeking only the whole body can be sent
+			req = req.Clone(req.Context())
+			req.Header.Del("Range")
+			content = &sizedReader{Reader: reader, size: length}
+		}
+		http.ServeContent(c.Writer, req, "", modtime, content)
+		return
+	}
+
+	if length >= 0 {
+		header.Set("Content-Length", fmt.Sprint(length))
+	}
+	c.Status(code)
+	if c.Req.Method != http.MethodHead {
+		io.Copy(c.Writer, reader)
+	}
+}
+
+// serveFile sends an open file with an ETag derived from its size and
+// modification time
+func (c *Context) serveFile(f http.File, name string) {
+	d, err := f.Stat()
+	if err != nil {
+		c.fileError(err)
+		return
+	}
+	if d.IsDir() {
+		c.fileError(fs.ErrNotExist)
+		return
+	}
+	if c.Writer.Header().Get("ETag") == "" {
+		c.SetHeader("ETag", fmt.Sprintf(`"%x-%x"`, d.ModTime().UnixNano(), d.Size()))
+	}
+	http.ServeContent(c.Writer, c.Req, filepath.Base(name), d.ModTime(), f)
+}
+
+func (c *Context) fileError(err error) {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		c.Fail(http.StatusNotFound, "file not found")
+	case errors.Is(err, fs.ErrPermission):
+		c.Fail(http.StatusForbidden, "forbidden")
+	default:
+		c.Fail(http.StatusInternalServerError, "Internal Server Error")
+	}
+}
+
+// sizedReader lets http.ServeContent learn the size of a plain reader
+// and read it from the start
+type sizedReader struct {
+	io.Reader
+	size int64
+	read bool
+}
+
+func (r *sizedReader) Read(p []byte) (int, error) {
+	r.read = true
+	return r.Reader.Read(p)
+}
+
+func (r *sizedReader) Seek(offset int64, whence int) (int64, error) {
+	switch {
+	case r.read:
+	case offset == 0 && whence == io.SeekStart:
+		return 0, nil
+	case offset == 0 && whence == io.SeekEnd:
+		return r.size, nil
+	}
+	return 0, errors.New("Lee: reader does not support seeking")
+}
+
+// attachmentDisposition builds a Content-Disposition header with an ASCII
+// filename for old clients and an RFC 5987 filename* for the others
+func attachmentDisposition(name string) string {
+	var fallback strings.Builder
+	plain := true
+	for _, r := range name {
+		switch {
+		case r == '"' || r == '\\':
+			fallback.WriteByte('\\')
+			fallback.WriteRune(r)
+		case r < 0x20 || r >= 0x7f:
+			fallback.WriteByte('_')
+			plain = false
+		default:
+			fallback.WriteRune(r)
+		}
+	}
+	disposition := `attachment; filename="` + fallback.String() + `"`
+	if !plain {
+		disposition += "; filename*=UTF-8''" + encodeRFC5987(name)
+	}
+	return disposition
+}
+
+// encodeRFC5987 percent-encodes everything but attr-char
+func encodeRFC5987(s string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || '0' <= ch && ch <= '9' ||
+			strings.IndexByte("!#$&+-.^_`|~", ch) >= 0 {
+			b.WriteByte(ch)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hex[ch>>4])
+		b.WriteByte(hex[ch&0xf])
+	}
+	return b.String()
+}
@@ -0,0 +1,316 @@
+package Lee
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/lpz1208/Lee/Lee/render"
+)
+
+// HTMLRender provides the renderers of Context.HTML. The engine uses the
+// templates loaded by its LoadHTML methods, SetHTMLRender replaces them,
+// for example with another template engine.
+type HTMLRender interface {
+	// Instance returns the renderer of the template name with data,
+	// inside layout unless it is empty.
+	Instance(layout, name string, data interface{}) (render.Render, error)
+}
+
+// HTMLFuncRender is an HTMLRender taking the funcs of SetFuncMap and
+// AddFunc. It is given the engine funcs when it is set and whenever they
+// change.
+type HTMLFuncRender interface {
+	HTMLRender
+	SetFuncMap(funcs template.FuncMap)
+}
+
+// ErrNoTemplates is the render error of Context.HTML before templates
+// are loaded.
+var ErrNoTemplates = errors.New("Lee: no HTML templates loaded, use LoadHTMLGlob or SetHTMLRender")
+
+// htmlSource is a list of template files, on disk or in an fs.FS, named
+// either literally or by glob patterns
+type htmlSource struct {
+	fsys     fs.FS // nil for the OS file system
+	names    []string
+	patterns []string
+}
+
+func (s *htmlSource) files() ([]string, error) {
+	files := append([]string(nil), s.names...)
+	for _, pattern := range s.patterns {
+		var matches []string
+		var err error
+		if s.fsys == nil {
+			matches, err = filepath.Glob(pattern)
+		} else {
+			matches, err = fs.Glob(s.fsys, pattern)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("Lee: pattern %q matches no templates", pattern)
+		}
+		files = append(files, matches...)
+	}
+	return files, nil
+}
+
+func (s *htmlSource) parse(t *template.Template, files ...string) (*template.Template, error) {
+	if s.fsys == nil {
+		return t.ParseFiles(files...)
+	}
+	return t.ParseFS(s.fsys, files...)
+}
+
+// fingerprint changes whenever a file is added, removed or modified
+func (s *htmlSource) fingerprint() (string, error) {
+	files, err := s.files()
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for _, name := range files {
+		var info fs.FileInfo
+		if s.fsys == nil {
+			info, err = os.Stat(name)
+		} else {
+			info, err = fs.Stat(s.fsys, name)
+		}
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, "%s|%d|%d\n", name, info.ModTime().UnixNano(), info.Size())
+	}
+	return b.String(), nil
+}
+
+// htmlSet holds the parsed templates: either one tree shared by all
+// names, or one tree per page. It is parsed again when its funcs change,
+// and in debug mode whenever its files change. A failed parse is kept
+// and reported by every lookup until then.
+type htmlSet struct {
+	shared *htmlSource // every template, or the partials of pages
+	pages  *htmlSource // nil for a single tree
+	funcs  template.FuncMap
+
+	mu    sync.RWMutex
+	stamp string
+	tree  *htmlTree
+	trees map[string]*htmlTree
+	err   error // of the last parse
+}
+
+func (h *htmlSet) stampNow() (string, error) {
+	stamp, err := h.shared.fingerprint()
+	if err != nil || h.pages == nil {
+		return stamp, err
+	}
+	pages, err := h.pages.fingerprint()
+	return stamp + pages, err
+}
+
+// load parses the templates and replaces the current ones, or keeps the
+// error until the next load
+func (h *htmlSet) load() error {
+	stamp, err := h.stampNow()
+	var tree *htmlTree
+	var trees map[string]*htmlTree
+	if err == nil {
+		tree, trees, err = h.parse()
+	}
+	h.mu.Lock()
+	h.tree, h.trees, h.stamp, h.err = tree, trees, stamp, err
+	h.mu.Unlock()
+	return err
+}
+
+// parse returns either the single tree or the trees of the pages
+func (h *htmlSet) parse() (*htmlTree, map[string]*htmlTree, error) {
+	h.mu.RLock()
+	funcs := h.funcs
+	h.mu.RUnlock()
+	shared, err := h.shared.files()
+	if err != nil {
+		return nil, nil, err
+	}
+	if h.pages == nil {
+		tree, err := h.shared.parse(h.newTemplate("", funcs), shared...)
+		if err != nil {
+			return nil, nil, err
+		}
+		return newHTMLTree(tree), nil, nil
+	}
+
+	pages, err := h.pages.files()
+	if err != nil {
+		return nil, nil, err
+	}
+	trees := make(map[string]*htmlTree, len(pages))
+	files := make(map[string]string, len(pages))
+	for _, page := range pages {
+		// pages are rendered by file name, which must be unique
+		name := path.Base(page)
+		if other, ok := files[name]; ok {
+			return nil, nil, fmt.Errorf("Lee: pages %s and %s are both named %q", other, page, name)
+		}
+		files[name] = page
+		tree := h.newTemplate(name, funcs)
+		if len(shared) > 0 {
+			if tree, err = h.shared.parse(tree, shared...); err != nil {
+				return nil, nil, err
+			}
+		}
+		// the page comes last, so its blocks override the partials
+		if tree, err = h.pages.parse(tree, page); err != nil {
+			return nil, nil, err
+		}
+		trees[name] = newHTMLTree(tree)
+	}
+	return nil, trees, nil
+}
+
+// newTemplate starts a tree with the layout helpers and the engine funcs
+func (h *htmlSet) newTemplate(name string, funcs template.FuncMap) *template.Template {
+	return template.New(name).Funcs(layoutFuncs).Funcs(funcs)
+}
+
+// SetFuncMap implements HTMLFuncRender. When the templates do not parse
+// with funcs, the error is reported when rendering.
+func (h *htmlSet) SetFuncMap(funcs template.FuncMap) {
+	h.setFuncs(funcs)
+}
+
+// setFuncs parses the templates again with new funcs
+func (h *htmlSet) setFuncs(funcs template.FuncMap) error {
+	h.mu.Lock()
+	h.funcs = funcs
+	h.mu.Unlock()
+	return h.load()
+}
+
+// Instance implements HTMLRender.
+func (h *htmlSet) Instance(layout, name string, data interface{}) (render.Render, error) {
+	tree, err := h.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	v, err := tree.view(layout, name)
+	if err != nil {
+		return nil, err
+	}
+	if layout == "" {
+		layout = name
+	}
+	return render.HTML{Template: v, Name: layout, Data: data}, nil
+}
+
+// lookup returns the tree holding the template called name
+func (h *htmlSet) lookup(name string) (*htmlTree, error) {
+	if IsDebugging() && h.shared != nil {
+		stamp, err := h.stampNow()
+		if err != nil {
+			return nil, err
+		}
+		h.mu.RLock()
+		changed := stamp != h.stamp
+		h.mu.RUnlock()
+		if changed {
+			if err := h.load(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.err != nil {
+		return nil, h.err
+	}
+	if h.tree != nil {
+		return h.tree, nil
+	}
+	tree, ok := h.trees[name]
+	if !ok {
+		return nil, fmt.Errorf("Lee: no page template %q", name)
+	}
+	return tree, nil
+}
+
+// loadHTML parses a template set and installs it, panicking on errors
+// like template.Must. Only a call of an undefined func is logged instead,
+// as the func may be added later.
+func (engine *Engine) loadHTML(h *htmlSet) {
+	if err := h.setFuncs(engine.funcMap); err != nil {
+		if !isUndefinedFunc(err) {
+			panic(err)
+		}
+		engine.log().Warn("templates are not usable until their funcs are added", "error", err)
+	}
+	engine.htmlRender = h
+}
+
+// isUndefinedFunc reports whether err is the parse error of a template
+// calling a func which is not defined
+func isUndefinedFunc(err error) bool {
+	msg := err.Error()
+	return strings.HasPrefix(msg, "template: ") && strings.Contains(msg, `: function "`) &&
+		strings.HasSuffix(msg, `" not defined`)
+}
+
+// SetHTMLRender replaces the templates used by Context.HTML. An
+// HTMLFuncRender is given the engine funcs.
+func (engine *Engine) SetHTMLRender(r HTMLRender) {
+	engine.htmlRender = r
+	engine.reloadFuncs()
+}
+
+// AddFunc makes fn available to templates as name. It can be called
+// before or after loading them, but not while serving. Templates using
+// a func that is not added yet fail to render until it is.
+func (engine *Engine) AddFunc(name string, fn interface{}) {
+	funcMap := make(template.FuncMap, len(engine.funcMap)+1)
+	for k, v := range engine.funcMap {
+		funcMap[k] = v
+	}
+	funcMap[name] = fn
+	engine.funcMap = funcMap
+	engine.reloadFuncs()
+}
+
+// reloadFuncs passes the engine funcs to the HTML renderer
+func (engine *Engine) reloadFuncs() {
+	if r, ok := engine.htmlRender.(HTMLFuncRender); ok {
+		r.SetFuncMap(engine.funcMap)
+	}
+}
+
+// LoadHTMLFS loads the templates matching patterns in fsys, for example
+// an embed.FS, into a single tree.
+func (engine *Engine) LoadHTMLFS(fsys fs.FS, patterns ...string) {
+	engine.loadHTML(&htmlSet{shared: &htmlSource{fsys: fsys, patterns: patterns}})
+}
+
+// LoadHTMLFiles loads the named template files into a single tree.
+func (engine *Engine) LoadHTMLFiles(files ...string) {
+	engine.loadHTML(&htmlSet{shared: &htmlSource{names: files}})
+}
+
+// LoadHTMLPages gives every file matching pages its own template tree,
+// holding the page and the files matching partials. Pages can define the
+// same blocks without clashing, and are rendered by file name, so two
+// pages with the same file name in different directories panic.
+func (engine *Engine) LoadHTMLPages(fsys fs.FS, pages string, partials ...string) {
+	engine.loadHTML(&htmlSet{
+		shared: &htmlSource{fsys: fsys, patterns: partials},
+		pages:  &htmlSource{fsys: fsys, patterns: []string{pages}},
+	})
+}
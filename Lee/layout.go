@@ -0,0 +1,118 @@
+package Lee
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"strings"
+	"sync"
+)
+
+// layoutFuncs are defined while parsing and bound to each view later
+var layoutFuncs = template.FuncMap{
+	"yield":   func(data ...interface{}) (template.HTML, error) { return "", errNoLayout },
+	"partial": func(name string, data ...interface{}) (template.HTML, error) { return "", nil },
+}
+
+var errNoLayout = errors.New("Lee: yield called outside a layout")
+
+// htmlTree is a parsed template tree. The master is never executed, so
+// it can be cloned into one view per layout and page.
+type htmlTree struct {
+	master *template.Template
+
+	mu    sync.Mutex
+	views map[[2]string]*template.Template
+}
+
+func newHTMLTree(master *template.Template) *htmlTree {
+	return &htmlTree{master: master, views: make(map[[2]string]*template.Template)}
+}
+
+// view returns the tree to render page in layout, where the page is
+// available as the "content" template and through yield. Pages rendered
+// without layout share a single view.
+func (t *htmlTree) view(layout, page string) (*template.Template, error) {
+	key := [2]string{layout, page}
+	if layout == "" {
+		key[1] = ""
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if v, ok := t.views[key]; ok {
+		return v, nil
+	}
+
+	v, err := t.master.Clone()
+	if err != nil {
+		return nil, err
+	}
+	execute := func(name string, data []interface{}) (template.HTML, error) {
+		var buf bytes.Buffer
+		var dot interface{}
+		if len(data) > 0 {
+			dot = data[0]
+		}
+		err := v.ExecuteTemplate(&buf, name, dot)
+		return template.HTML(buf.String()), err
+	}
+	funcs := template.FuncMap{
+		"partial": func(name string, data ...interface{}) (template.HTML, error) {
+			return execute(name, data)
+		},
+	}
+	if layout != "" {
+		if v.Lookup(layout) == nil {
+			return nil, fmt.Errorf("Lee: no layout template %q", layout)
+		}
+		pageTemplate := v.Lookup(page)
+		if pageTemplate == nil {
+			return nil, fmt.Errorf("Lee: no template %q", page)
+		}
+		if _, err := v.AddParseTree("content", pageTemplate.Tree); err != nil {
+			return nil, err
+		}
+		funcs["yield"] = func(data ...interface{}) (template.HTML, error) {
+			return execute(page, data)
+		}
+	}
+	v.Funcs(funcs)
+	t.views[key] = v
+	return v, nil
+}
+
+// SetLayout renders the HTML pages of the group inside the layout
+// template name, which shows the page with {{template "content" .}} or
+// {{yield .}}. The deepest group with a layout wins, and an empty name
+// turns layouts off. Set it on the engine for a default layout.
+func (group *RouterGroup) SetLayout(name string) {
+	group.layout = &name
+}
+
+// layout returns the layout of the deepest group matching the request
+func (c *Context) layout() string {
+	var layout string
+	depth := -1
+	for _, group := range c.engine.groups {
+		if group.layout != nil && len(group.prefix) > depth && strings.HasPrefix(c.Path, group.prefix) {
+			layout, depth = *group.layout, len(group.prefix)
+		}
+	}
+	return layout
+}
+
+// HTMLLayout renders the template name inside layout, instead of the
+// layout of the group. An empty layout renders the page alone.
+func (c *Context) HTMLLayout(code int, layout, name string, data interface{}) {
+	if c.engine.htmlRender == nil {
+		c.renderError(ErrNoTemplates)
+		return
+	}
+	r, err := c.engine.htmlRender.Instance(layout, name, data)
+	if err != nil {
+		c.renderError(err)
+		return
+	}
+	c.Render(code, r)
+}
@@ -1,17 +1,342 @@
 package Lee
 
 import (
-	"log"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
+	"unicode"
 )
 
+// SetLogger sets the logger of the framework and of Context.Logger,
+// slog.Default() by default.
+func (engine *Engine) SetLogger(logger *slog.Logger) {
+	engine.logger = logger
+}
+
+// log returns the logger of the engine
+func (engine *Engine) log() *slog.Logger {
+	if engine.logger == nil {
+		return slog.Default()
+	}
+	return engine.logger
+}
+
+// Logger returns a logger carrying the attributes of the request:
+// method, path, route, client IP, request ID and user agent.
+func (c *Context) Logger() *slog.Logger {
+	if c.logger == nil {
+		c.logger = c.engine.log().With(c.requestAttrs()...)
+	}
+	return c.logger
+}
+
+func (c *Context) requestAttrs() []any {
+	attrs := []any{
+		slog.String("method", c.Method),
+		slog.String("path", c.Path),
+		slog.String("route", c.fullPath),
+		slog.String("client_ip", c.ClientIP()),
+	}
+	if id := c.requestID(); id != "" {
+		attrs = append(attrs, slog.String("request_id", id))
+	}
+	if ua := c.Req.UserAgent(); ua != "" {
+		attrs = append(attrs, slog.String("user_agent", ua))
+	}
+	return attrs
+}
+
+// requestID returns the X-Request-ID of the request, or the one set on
+// the response by a middleware
+func (c *Context) requestID() string {
+	if id := c.Req.Header.Get("X-Request-ID"); id != "" {
+		return id
+	}
+	return c.Writer.Header().Get("X-Request-ID")
+}
+
+// Logger logs every request through the logger of the engine, with the
+// attributes of Context.Logger plus status, latency and bytes.
 func Logger() HandlerFunc {
+	return LoggerWithConfig(LoggerConfig{})
+}
+
+// Access log formats of LoggerConfig.
+const (
+	LogFormatCommon   = "common"   // Apache common log format
+	LogFormatCombined = "combined" // Apache combined log format
+	LogFormatJSON     = "json"     // one JSON object per line
+	LogFormatLogfmt   = "logfmt"   // key=value pairs
+)
+
+// LogFormatterParams describes a finished request to a LogFormatter.
+type LogFormatterParams struct {
+	Request   *http.Request
+	TimeStamp time.Time
+	Latency   time.Duration
+	Status    int
+	BodySize  int
+	ClientIP  string
+	Method    string
+	Path      string // the request URI, with the query
+	Route     string
+	RequestID string
+	UserAgent string
+	Referer   string
+	User      string // from basic auth
+	// Color tells whether the line goes to a terminal and may be colored
+	Color bool
+}
+
+// LogFormatter formats the access log line of a request, without the
+// trailing newline.
+type LogFormatter func(params LogFormatterParams) string
+
+// LoggerConfig configures LoggerWithConfig.
+type LoggerConfig struct {
+	// Format names a built-in format. Without Format and Formatter,
+	// requests go to the slog logger of the engine, like Logger.
+	Format string
+	// Formatter formats lines itself, Format is ignored then.
+	Formatter LogFormatter
+	// Output receives the lines, os.Stdout by default.
+	Output io.Writer
+	// SkipPaths are request paths not logged, such as health checks.
+	SkipPaths []string
+	// Skip decides after the request whether not to log it.
+	Skip func(c *Context) bool
+	// Color colors status codes and methods when Output is a terminal.
+	Color bool
+}
+
+var logFormatters = map[string]LogFormatter{
+	LogFormatCommon:   commonLogFormatter,
+	LogFormatCombined: combinedLogFormatter,
+	LogFormatJSON:     jsonLogFormatter,
+	LogFormatLogfmt:   logfmtFormatter,
+}
+
+// LoggerWithConfig returns an access log middleware.
+func LoggerWithConfig(config LoggerConfig) HandlerFunc {
+	formatter := config.Formatter
+	if formatter == nil && config.Format != "" {
+		var ok bool
+		if formatter, ok = logFormatters[config.Format]; !ok {
+			panic("Lee: unknown log format " + config.Format)
+		}
+	}
+	out := config.Output
+	if out == nil {
+		out = os.Stdout
+	}
+	color := config.Color && isTerminal(out)
+	skipPaths := make(map[string]bool, len(config.SkipPaths))
+	for _, path := range config.SkipPaths {
+		skipPaths[path] = true
+	}
+	var mu sync.Mutex
+
 	return func(c *Context) {
 		// Start timer
 		t := time.Now()
+		path := c.Path
 		// Process request
 		c.Next()
+		if skipPaths[path] || config.Skip != nil && config.Skip(c) {
+			return
+		}
 		// Calculate resolution time
-		log.Printf("[%d] %s in %v", c.StatusCode, c.Req.RequestURI, time.Since(t))
+		latency := time.Since(t)
+		if formatter == nil {
+			c.logRequest(latency)
+			return
+		}
+
+		params := LogFormatterParams{
+			Request:   c.Req,
+			TimeStamp: t,
+			Latency:   latency,
+			Status:    c.Writer.Status(),
+			BodySize:  c.Writer.Size(),
+			ClientIP:  c.ClientIP(),
+			Method:    c.Method,
+			Path:      c.Req.RequestURI,
+			Route:     c.fullPath,
+			RequestID: c.requestID(),
+			UserAgent: c.Req.UserAgent(),
+			Referer:   c.Req.Referer(),
+			Color:     color,
+		}
+		if params.Path == "" {
+			params.Path = c.Req.URL.RequestURI()
+		}
+		params.User, _, _ = c.Req.BasicAuth()
+		line := formatter(params) + "\n"
+		mu.Lock()
+		io.WriteString(out, line)
+		mu.Unlock()
+	}
+}
+
+// logRequest writes the slog record of Logger
+func (c *Context) logRequest(latency time.Duration) {
+	status := c.Writer.Status()
+	level := slog.LevelInfo
+	switch {
+	case status >= 500:
+		level = slog.LevelError
+	case status >= 400:
+		level = slog.LevelWarn
+	}
+	c.Logger().LogAttrs(c.Req.Context(), level, "request",
+		slog.Int("status", status),
+		slog.Duration("latency", latency),
+		slog.Int("bytes", c.Writer.Size()),
+	)
+}
+
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+const (
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+	colorRed    = "\033[31m"
+	colorBlue   = "\033[34m"
+	colorReset  = "\033[0m"
+)
+
+// statusText returns the status, colored by class when p.Color is set
+func (p LogFormatterParams) statusText() string {
+	return p.colorStatus(strconv.Itoa(p.Status))
+}
+
+func (p LogFormatterParams) methodText() string {
+	return p.colorMethod(p.Method)
+}
+
+// colorStatus colors s by the class of the status when p.Color is set
+func (p LogFormatterParams) colorStatus(s string) string {
+	if !p.Color {
+		return s
+	}
+	switch {
+	case p.Status >= 500:
+		return colorRed + s + colorReset
+	case p.Status >= 400:
+		return colorYellow + s + colorReset
+	}
+	return colorGreen + s + colorReset
+}
+
+func (p LogFormatterParams) colorMethod(s string) string {
+	if !p.Color {
+		return s
+	}
+	return colorBlue + s + colorReset
+}
+
+func dashIfEmpty(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// apacheEscape escapes s like Apache escapes request fields: quotes and
+// backslashes with a backslash, control characters as \xHH, and spaces
+// as well unless they are allowed
+func apacheEscape(s string, spaces bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch ch := s[i]; {
+		case ch == '"' || ch == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(ch)
+		case ch < 0x20 || ch == 0x7f || ch == ' ' && !spaces:
+			fmt.Fprintf(&b, `\x%02x`, ch)
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	return b.String()
+}
+
+func commonLogFormatter(p LogFormatterParams) string {
+	size := "-"
+	if p.BodySize > 0 {
+		size = strconv.Itoa(p.BodySize)
+	}
+	return fmt.Sprintf(`%s - %s [%s] "%s %s %s" %s %s`,
+		dashIfEmpty(p.ClientIP), dashIfEmpty(apacheEscape(p.User, false)), p.TimeStamp.Format("02/Jan/2006:15:04:05 -0700"),
+		p.methodText(), apacheEscape(p.Path, true), p.Request.Proto, p.statusText(), size)
+}
+
+func combinedLogFormatter(p LogFormatterParams) string {
+	return fmt.Sprintf(`%s %q %q`, commonLogFormatter(p), dashIfEmpty(p.Referer), dashIfEmpty(p.UserAgent))
+}
+
+func jsonLogFormatter(p LogFormatterParams) string {
+	line, _ := json.Marshal(struct {
+		Time      string  `json:"time"`
+		Method    string  `json:"method"`
+		Path      string  `json:"path"`
+		Route     string  `json:"route,omitempty"`
+		Status    int     `json:"status"`
+		LatencyMS float64 `json:"latency_ms"`
+		Bytes     int     `json:"bytes"`
+		ClientIP  string  `json:"client_ip"`
+		RequestID string  `json:"request_id,omitempty"`
+		UserAgent string  `json:"user_agent,omitempty"`
+	}{
+		p.TimeStamp.Format(time.RFC3339Nano), p.Method, p.Path, p.Route, p.Status,
+		float64(p.Latency) / float64(time.Millisecond), p.BodySize, p.ClientIP, p.RequestID, p.UserAgent,
+	})
+	return string(line)
+}
+
+func logfmtFormatter(p LogFormatterParams) string {
+	var b strings.Builder
+	// color is applied after quoting, so escape codes are never quoted
+	pair := func(key, value string, color func(string) string) {
+		if value == "" {
+			return
+		}
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(key)
+		b.WriteByte('=')
+		if strings.ContainsAny(value, " =\"\\") || strings.ContainsFunc(value, unicode.IsControl) {
+			value = strconv.Quote(value)
+		}
+		if color != nil {
+			value = color(value)
+		}
+		b.WriteString(value)
 	}
+	pair("time", p.TimeStamp.Format(time.RFC3339), nil)
+	pair("method", p.Method, p.colorMethod)
+	pair("path", p.Path, nil)
+	pair("route", p.Route, nil)
+	pair("status", strconv.Itoa(p.Status), p.colorStatus)
+	pair("latency", p.Latency.String(), nil)
+	pair("bytes", strconv.Itoa(p.BodySize), nil)
+	pair("client_ip", p.ClientIP, nil)
+	pair("request_id", p.RequestID, nil)
+	pair("user_agent", p.UserAgent, nil)
+	return b.String()
 }
@@ -0,0 +1,62 @@
+package Lee
+
+import (
+	"os"
+	"sync/atomic"
+)
+
+// EnvLeeMode is the environment variable the mode is read from.
+const EnvLeeMode = "LEE_MODE"
+
+const (
+	// DebugMode logs routes, reloads templates on every render, shows
+	// panic details and adds route-trace headers. Never use it in
+	// production.
+	DebugMode = "debug"
+	// ReleaseMode is the default, quiet and safe to expose.
+	ReleaseMode = "release"
+	// TestMode behaves like ReleaseMode, for tests.
+	TestMode = "test"
+)
+
+const (
+	releaseCode int32 = iota
+	debugCode
+	testCode
+)
+
+var modeCode atomic.Int32
+
+func init() {
+	SetMode(os.Getenv(EnvLeeMode))
+}
+
+// SetMode sets the mode of Lee. An empty value selects ReleaseMode.
+func SetMode(value string) {
+	switch value {
+	case ReleaseMode, "":
+		modeCode.Store(releaseCode)
+	case DebugMode:
+		modeCode.Store(debugCode)
+	case TestMode:
+		modeCode.Store(testCode)
+	default:
+		panic("Lee: unknown mode " + value + ", use debug, release or test")
+	}
+}
+
+// Mode returns the current mode.
+func Mode() string {
+	switch modeCode.Load() {
+	case debugCode:
+		return DebugMode
+	case testCode:
+		return TestMode
+	}
+	return ReleaseMode
+}
+
+// IsDebugging reports whether Lee runs in DebugMode.
+func IsDebugging() bool {
+	return modeCode.Load() == debugCode
+}
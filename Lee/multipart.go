@@ -0,0 +1,117 @@
+package Lee
+
+import (
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrInvalidFilename is returned by SaveUploadedFile when the destination
+// would escape its directory.
+var ErrInvalidFilename = errors.New("Lee: invalid upload filename")
+
+// parseMultipartForm parses the body with the engine memory limit, before
+// FormValue gets the chance to use the default one. The error is kept,
+// as the body cannot be read twice.
+func (c *Context) parseMultipartForm() error {
+	if c.Req.MultipartForm != nil || c.formErr != nil {
+		return c.formErr
+	}
+	err := c.Req.ParseMultipartForm(c.engine.MaxMultipartMemory)
+	if errors.Is(err, http.ErrNotMultipart) {
+		return nil
+	}
+	c.formErr = err
+	return err
+}
+
+// FormError returns the error of parsing the form for PostForm, which
+// tells an unreadable or too large body from a missing field.
+func (c *Context) FormError() error {
+	return c.formErr
+}
+
+// MultipartForm returns the parsed multipart form, including the files.
+func (c *Context) MultipartForm() (*multipart.Form, error) {
+	if err := c.Req.ParseMultipartForm(c.engine.MaxMultipartMemory); err != nil {
+		return nil, err
+	}
+	return c.Req.MultipartForm, nil
+}
+
+// FormFile returns the first file uploaded under name.
+func (c *Context) FormFile(name string) (*multipart.FileHeader, error) {
+	if err := c.parseMultipartForm(); err != nil {
+		return nil, err
+	}
+	f, fh, err := c.Req.FormFile(name)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+	return fh, nil
+}
+
+// MultipartReader returns a reader over the parts of a multipart body,
+// so large uploads can be streamed instead of parsed into memory.
+func (c *Context) MultipartReader() (*multipart.Reader, error) {
+	return c.Req.MultipartReader()
+}
+
+// SaveUploadedFile writes an uploaded file to dst. When dst is a
+// directory, or ends with a slash, the file is saved in it under the
+// base of its client-side name. Destinations climbing out with ".." are
+// rejected with ErrInvalidFilename.
+func (c *Context) SaveUploadedFile(fh *multipart.FileHeader, dst string) error {
+	if info, err := os.Stat(dst); strings.HasSuffix(dst, "/") || err == nil && info.IsDir() {
+		name := uploadFilename(fh.Filename)
+		if name == "" {
+			return ErrInvalidFilename
+		}
+		dst = filepath.Join(dst, name)
+	} else if containsDotDot(dst) {
+		return ErrInvalidFilename
+	}
+
+	src, err := fh.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	if err := os.MkdirAll(filepath.Dir(dst), 0o750); err != nil {
+		return err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, src); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// uploadFilename reduces a client-side filename to its base name,
+// whatever separators the client used
+func uploadFilename(name string) string {
+	name = strings.ReplaceAll(name, "\\", "/")
+	name = name[strings.LastIndexByte(name, '/')+1:]
+	if name == "." || name == ".." || strings.ContainsRune(name, 0) {
+		return ""
+	}
+	return name
+}
+
+func containsDotDot(p string) bool {
+	for _, elem := range strings.FieldsFunc(filepath.ToSlash(p), func(r rune) bool { return r == '/' }) {
+		if elem == ".." {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,153 @@
+package Lee
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MIME types understood by Negotiate
+const (
+	MIMEJSON  = "application/json"
+	MIMEHTML  = "text/html"
+	MIMEXML   = "application/xml"
+	MIMEXML2  = "text/xml"
+	MIMEPlain = "text/plain"
+	MIMEYAML  = "application/yaml"
+	MIMETOML  = "application/toml"
+)
+
+// Negotiate holds the formats and data offered by Context.Negotiate.
+// Data is used for formats whose specific field is nil.
+type Negotiate struct {
+	Offered  []string
+	HTMLName string
+	HTMLData interface{}
+	JSONData interface{}
+	XMLData  interface{}
+	YAMLData interface{}
+	TOMLData interface{}
+	TextData interface{}
+	Data     interface{}
+}
+
+// mediaRange is one entry of an Accept header
+type mediaRange struct {
+	typ, subtype string
+	q            float64
+}
+
+// specificity ranks */* below type/* below type/subtype
+func (m mediaRange) specificity() int {
+	switch {
+	case m.typ == "*":
+		return 0
+	case m.subtype == "*":
+		return 1
+	}
+	return 2
+}
+
+func (m mediaRange) matches(typ, subtype string) bool {
+	return (m.typ == "*" || m.typ == typ) && (m.subtype == "*" || m.subtype == subtype)
+}
+
+func parseAccept(header string) []mediaRange {
+	var ranges []mediaRange
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		typ, subtype, ok := strings.Cut(strings.ToLower(strings.TrimSpace(params[0])), "/")
+		if !ok || typ == "" || subtype == "" {
+			continue
+		}
+		r := mediaRange{typ: typ, subtype: subtype, q: 1}
+		for _, param := range params[1:] {
+			key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.EqualFold(key, "q") {
+				q, err := strconv.ParseFloat(value, 64)
+				if err != nil || q < 0 || q > 1 {
+					q = 0
+				}
+				r.q = q
+			}
+		}
+		ranges = append(ranges, r)
+	}
+	// the most specific range decides the quality of a type
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].specificity() > ranges[j].specificity()
+	})
+	return ranges
+}
+
+// NegotiateFormat returns the offered MIME type the client prefers
+// according to its Accept header, or "" if none is acceptable. Ties are
+// resolved in the order of offered.
+func (c *Context) NegotiateFormat(offered ...string) string {
+	if len(offered) == 0 {
+		return ""
+	}
+	accept := c.Req.Header.Values("Accept")
+	if len(accept) == 0 {
+		return offered[0]
+	}
+	ranges := parseAccept(strings.Join(accept, ","))
+	best, bestQ := "", 0.0
+	for _, offer := range offered {
+		typ, subtype, _ := strings.Cut(strings.ToLower(offer), "/")
+		for _, r := range ranges {
+			if r.matches(typ, subtype) {
+				if r.q > bestQ {
+					best, bestQ = offer, r.q
+				}
+				break
+			}
+		}
+	}
+	return best
+}
+
+// Negotiate renders the data of the format preferred by the client,
+// or fails with 406 Not Acceptable.
+func (c *Context) Negotiate(code int, config Negotiate) {
+	c.addVary("Accept")
+	pick := func(data interface{}) interface{} {
+		if data == nil {
+			return config.Data
+		}
+		return data
+	}
+	switch c.NegotiateFormat(config.Offered...) {
+	case MIMEJSON:
+		c.JSON(code, pick(config.JSONData))
+	case MIMEHTML:
+		c.HTML(code, config.HTMLName, pick(config.HTMLData))
+	case MIMEXML:
+		c.XML(code, pick(config.XMLData))
+	case MIMEXML2:
+		c.Writer.Header().Set("Content-Type", "text/xml; charset=utf-8")
+		c.XML(code, pick(config.XMLData))
+	case MIMEYAML:
+		c.YAML(code, pick(config.YAMLData))
+	case MIMETOML:
+		c.TOML(code, pick(config.TOMLData))
+	case MIMEPlain:
+		c.String(code, "%v", pick(config.TextData))
+	default:
+		c.Fail(http.StatusNotAcceptable, "the accepted formats are not offered by the server")
+	}
+}
+
+// addVary adds field to the Vary header unless it is already listed
+func (c *Context) addVary(field string) {
+	header := c.Writer.Header()
+	for _, value := range header.Values("Vary") {
+		for _, v := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(v), field) {
+				return
+			}
+		}
+	}
+	header.Add("Vary", field)
+}
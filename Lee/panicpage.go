@@ -0,0 +1,222 @@
+package Lee
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/lpz1208/Lee/Lee/render"
+)
+
+// sourceContext is the number of lines shown around each frame
+const sourceContext = 5
+
+// stackFrame is a call of a panic stack, with the source around it
+type stackFrame struct {
+	Function string       `json:"function"`
+	File     string       `json:"file"`
+	Line     int          `json:"line"`
+	Source   []sourceLine `json:"source,omitempty"`
+}
+
+type sourceLine struct {
+	Number  int    `json:"number"`
+	Code    string `json:"code"`
+	Current bool   `json:"current,omitempty"`
+}
+
+// panicFrames returns the stack of the goroutine, starting at the call
+// that panicked when called while recovering. Runtime frames are left out.
+func panicFrames() []stackFrame {
+	var pcs [64]uintptr
+	n := runtime.Callers(2, pcs[:])
+	frames := runtime.CallersFrames(pcs[:n])
+	var stack []stackFrame
+	for {
+		frame, more := frames.Next()
+		switch {
+		case frame.Function == "runtime.gopanic":
+			// everything above is the recovery itself
+			stack = stack[:0]
+		case !strings.HasPrefix(frame.Function, "runtime."):
+			stack = append(stack, stackFrame{Function: frame.Function, File: frame.File, Line: frame.Line})
+		}
+		if !more {
+			return stack
+		}
+	}
+}
+
+// readSource fills in the source lines of the frames, when the files
+// are on disk
+func readSource(stack []stackFrame) {
+	files := make(map[string][]string)
+	for i := range stack {
+		f := &stack[i]
+		lines, ok := files[f.File]
+		if !ok {
+			if data, err := os.ReadFile(f.File); err == nil {
+				lines = strings.Split(string(data), "\n")
+			}
+			files[f.File] = lines
+		}
+		if f.Line < 1 || f.Line > len(lines) {
+			continue
+		}
+		for n := max(1, f.Line-sourceContext); n <= min(len(lines), f.Line+sourceContext); n++ {
+			f.Source = append(f.Source, sourceLine{Number: n, Code: lines[n-1], Current: n == f.Line})
+		}
+	}
+}
+
+// errorCauses returns the errors wrapped by err, outermost first
+func errorCauses(err any) []string {
+	e, ok := err.(error)
+	if !ok {
+		return nil
+	}
+	var causes []string
+	queue := unwrapErrors(e)
+	for len(queue) > 0 && len(causes) < 16 {
+		e, queue = queue[0], queue[1:]
+		causes = append(causes, fmt.Sprintf("%T: %s", e, e))
+		queue = append(queue, unwrapErrors(e)...)
+	}
+	return causes
+}
+
+func unwrapErrors(err error) []error {
+	switch u := err.(type) {
+	case interface{ Unwrap() error }:
+		if e := u.Unwrap(); e != nil {
+			return []error{e}
+		}
+	case interface{ Unwrap() []error }:
+		return u.Unwrap()
+	}
+	return nil
+}
+
+// panicReport is the content of the debug panic page
+type panicReport struct {
+	Message string            `json:"message"`
+	Error   string            `json:"error"`
+	Type    string            `json:"type"`
+	Causes  []string          `json:"causes,omitempty"`
+	Frames  []stackFrame      `json:"frames"`
+	Request panicRequest      `json:"request"`
+	Route   string            `json:"route"`
+	Params  map[string]string `json:"params,omitempty"`
+	Keys    map[string]string `json:"keys,omitempty"`
+}
+
+type panicRequest struct {
+	Method     string              `json:"method"`
+	URL        string              `json:"url"`
+	Proto      string              `json:"proto"`
+	RemoteAddr string              `json:"remote_addr"`
+	Headers    map[string][]string `json:"headers"`
+}
+
+func newPanicReport(c *Context, err any, stack []stackFrame, redact []string) panicReport {
+	headers := c.Req.Header.Clone()
+	redactHeaders(headers, redact)
+	report := panicReport{
+		Message: "Internal Server Error",
+		Error:   fmt.Sprintf("%v", err),
+		Type:    fmt.Sprintf("%T", err),
+		Causes:  errorCauses(err),
+		Frames:  stack,
+		Request: panicRequest{
+			Method:     c.Req.Method,
+			URL:        c.Req.URL.String(),
+			Proto:      c.Req.Proto,
+			RemoteAddr: c.Req.RemoteAddr,
+			Headers:    headers,
+		},
+		Route:  c.fullPath,
+		Params: c.Params,
+	}
+	if len(c.Keys) > 0 {
+		report.Keys = make(map[string]string, len(c.Keys))
+		for k, v := range c.Keys {
+			report.Keys[k] = fmt.Sprintf("%+v", v)
+		}
+	}
+	return report
+}
+
+// renderPanicPage answers a panic with its details, as HTML or as JSON
+// when the client prefers it, with the headers in redact hidden. Only
+// used in debug mode.
+func renderPanicPage(c *Context, err any, redact []string) {
+	stack := panicFrames()
+	readSource(stack)
+	report := newPanicReport(c, err, stack, redact)
+	c.addVary("Accept")
+	if c.NegotiateFormat(MIMEHTML, MIMEJSON) == MIMEJSON {
+		c.JSON(http.StatusInternalServerError, report)
+		return
+	}
+	c.Render(http.StatusInternalServerError, render.HTML{Template: panicPage, Data: report})
+}
+
+// sortedKeys returns the keys of m in order, for the panic page
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var panicPage = template.Must(template.New("panic").Funcs(template.FuncMap{
+	"headerKeys": sortedKeys[[]string],
+	"stringKeys": sortedKeys[string],
+	"join":       strings.Join,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>panic: {{.Error}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+h1 { color: #b00; font-size: 1.4em; }
+pre { background: #f6f6f6; padding: .5em; overflow-x: auto; margin: .3em 0 1em; }
+.current { background: #fdd; display: block; }
+.file { color: #666; font-size: .9em; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+td, th { text-align: left; padding: .2em 1em .2em 0; vertical-align: top; font-family: monospace; }
+</style>
+</head>
+<body>
+<h1>panic: {{.Error}}</h1>
+<p>{{.Type}}{{with .Route}} in route <code>{{.}}</code>{{end}}</p>
+{{with .Causes}}<h2>Wrapped errors</h2>
+<ol>{{range .}}<li><code>{{.}}</code></li>{{end}}</ol>{{end}}
+<h2>Stack</h2>
+{{range .Frames}}<div><strong>{{.Function}}</strong> <span class="file">{{.File}}:{{.Line}}</span>
+{{with .Source}}<pre>{{range .}}<span{{if .Current}} class="current"{{end}}>{{printf "%4d" .Number}}  {{.Code}}</span>
+{{end}}</pre>{{else}}<br>{{end}}</div>
+{{end}}
+<h2>Request</h2>
+<table>
+<tr><th>Method</th><td>{{.Request.Method}}</td></tr>
+<tr><th>URL</th><td>{{.Request.URL}}</td></tr>
+<tr><th>Protocol</th><td>{{.Request.Proto}}</td></tr>
+<tr><th>Remote address</th><td>{{.Request.RemoteAddr}}</td></tr>
+</table>
+{{with .Params}}<h2>Params</h2>
+<table>{{range $k := stringKeys .}}<tr><th>{{$k}}</th><td>{{index $.Params $k}}</td></tr>{{end}}</table>{{end}}
+{{with .Keys}}<h2>Keys</h2>
+<table>{{range $k := stringKeys .}}<tr><th>{{$k}}</th><td>{{index $.Keys $k}}</td></tr>{{end}}</table>{{end}}
+<h2>Headers</h2>
+<table>{{range $k := headerKeys .Request.Headers}}<tr><th>{{$k}}</th><td>{{join (index $.Request.Headers $k) ", "}}</td></tr>{{end}}</table>
+</body>
+</html>
+`))
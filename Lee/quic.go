@@ -0,0 +1,68 @@
+package Lee
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// RunQUIC serves HTTP/3 on the UDP port of addr, along with HTTPS over
+// TCP on the same port for clients without HTTP/3. Responses over TCP
+// advertise HTTP/3 with Alt-Svc, so clients can switch to it.
+func (engine *Engine) RunQUIC(addr, certFile, keyFile string) error {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	// use the port picked for TCP, in case addr has none
+	host, _, _ := net.SplitHostPort(addr)
+	port := ln.Addr().(*net.TCPAddr).Port
+	udpConn, err := net.ListenPacket("udp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		ln.Close()
+		return err
+	}
+	defer udpConn.Close()
+
+	opts := engine.serverOptions(addr)
+	h3 := &http3.Server{
+		Addr:           addr,
+		Port:           port,
+		Handler:        engine,
+		TLSConfig:      http3.ConfigureTLSConfig(tlsConfig),
+		MaxHeaderBytes: opts.MaxHeaderBytes,
+		IdleTimeout:    timeoutOption(opts.IdleTimeout, 2*time.Minute),
+	}
+	engine.track(h3)
+	srv := engine.Server(&opts)
+	srv.TLSConfig = tlsConfig
+	srv.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h3.SetQUICHeaders(w.Header())
+		engine.ServeHTTP(w, r)
+	})
+
+	errc := make(chan error, 2)
+	go func() { errc <- h3.Serve(udpConn) }()
+	go func() { errc <- srv.ServeTLS(ln, "", "") }()
+	// when one side fails the other one is stopped too
+	err = <-errc
+	if !errors.Is(err, http.ErrServerClosed) {
+		h3.Close()
+		srv.Close()
+	}
+	if err2 := <-errc; errors.Is(err, http.ErrServerClosed) {
+		err = err2
+	}
+	return err
+}
@@ -1,38 +1,163 @@
 package Lee
 
 import (
+	"errors"
 	"fmt"
-	"log"
+	"io"
 	"net/http"
-	"runtime"
+	"net/http/httputil"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 )
 
-// print stack trace for debug
+// trace returns message and the stack of the panic, one call per line
 func trace(message string) string {
-	var pcs [32]uintptr
-	n := runtime.Callers(3, pcs[:]) // skip first 3 caller
-
 	var str strings.Builder
 	str.WriteString(message + "\nTraceback:")
-	for _, pc := range pcs[:n] {
-		fn := runtime.FuncForPC(pc)
-		file, line := fn.FileLine(pc)
-		str.WriteString(fmt.Sprintf("\n\t%s:%d", file, line))
+	for _, f := range panicFrames() {
+		str.WriteString(fmt.Sprintf("\n\t%s:%d %s", f.File, f.Line, f.Function))
 	}
 	return str.String()
 }
 
+// Recovery recovers from panics, logs them through Context.Logger and
+// answers 500. In debug mode the answer is a page with the stack, its
+// source and the request, in HTML or JSON.
 func Recovery() HandlerFunc {
+	return RecoveryWithConfig(RecoveryConfig{})
+}
+
+// RecoveryFunc answers a request whose handler panicked with err.
+type RecoveryFunc func(c *Context, err any)
+
+// RecoveryConfig configures RecoveryWithConfig.
+type RecoveryConfig struct {
+	// Handler answers the request, by default with a 500. It is not
+	// called when the client went away or the response was already sent.
+	Handler RecoveryFunc
+	// Output receives the panics as text. They are logged through
+	// Context.Logger when it is nil.
+	Output io.Writer
+	// DumpRequest adds the request line and headers to the log, with
+	// the headers in RedactHeaders hidden.
+	DumpRequest bool
+	// RedactHeaders are hidden in request dumps, Authorization, Cookie
+	// and Proxy-Authorization by default.
+	RedactHeaders []string
+}
+
+var defaultRedactHeaders = []string{"Authorization", "Cookie", "Proxy-Authorization"}
+
+// RecoveryWithConfig returns a recovery middleware. Panics with
+// http.ErrAbortHandler are passed on, to abort the response silently.
+func RecoveryWithConfig(config RecoveryConfig) HandlerFunc {
+	redact := config.RedactHeaders
+	if redact == nil {
+		redact = defaultRedactHeaders
+	}
+	handler := config.Handler
+	if handler == nil {
+		handler = func(c *Context, err any) { defaultRecovery(c, err, redact) }
+	}
+	var mu sync.Mutex
+
 	return func(c *Context) {
 		defer func() {
-			if err := recover(); err != nil {
-				message := fmt.Sprintf("%s", err)
-				log.Printf("%s\n\n", trace(message))
-				c.Fail(http.StatusInternalServerError, "Internal Server Error")
+			err := recover()
+			if err == nil {
+				return
+			}
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+			message := fmt.Sprintf("%v", err)
+			brokenPipe := isBrokenPipe(err)
+			var stack, dump string
+			if !brokenPipe {
+				stack = trace(message)
+			}
+			if config.DumpRequest {
+				dump = dumpRequest(c.Req, redact)
+			}
+
+			switch {
+			case config.Output != nil:
+				var b strings.Builder
+				fmt.Fprintf(&b, "[Recovery] %s panic recovered: %s\n", time.Now().Format("2006/01/02 - 15:04:05"), message)
+				if dump != "" {
+					b.WriteString(dump)
+				}
+				if stack != "" {
+					b.WriteString(stack + "\n")
+				}
+				mu.Lock()
+				io.WriteString(config.Output, b.String())
+				mu.Unlock()
+			case brokenPipe:
+				c.Logger().Warn("connection lost", "error", message)
+			default:
+				attrs := []any{"error", message, "stack", stack}
+				if dump != "" {
+					attrs = append(attrs, "request", dump)
+				}
+				c.Logger().Error("panic recovered", attrs...)
 			}
+
+			// nothing can be sent to a client that went away, and a started
+			// response can't be replaced
+			c.index = len(c.handlers)
+			if brokenPipe || c.Writer.Written() {
+				return
+			}
+			handler(c, err)
 		}()
 
 		c.Next()
 	}
 }
+
+// defaultRecovery answers 500, with the panic page in debug mode
+func defaultRecovery(c *Context, err any, redact []string) {
+	if IsDebugging() {
+		renderPanicPage(c, err, redact)
+		return
+	}
+	c.Fail(http.StatusInternalServerError, "Internal Server Error")
+}
+
+// isBrokenPipe reports whether err comes from writing to a closed
+// connection, which can't be answered
+func isBrokenPipe(err any) bool {
+	e, ok := err.(error)
+	if !ok {
+		return false
+	}
+	if errors.Is(e, syscall.EPIPE) || errors.Is(e, syscall.ECONNRESET) {
+		return true
+	}
+	// errors formatted with %v lose their cause
+	msg := strings.ToLower(e.Error())
+	return strings.Contains(msg, "broken pipe") || strings.Contains(msg, "connection reset by peer")
+}
+
+// dumpRequest returns the request line and headers, with redact hidden
+func dumpRequest(req *http.Request, redact []string) string {
+	r := req.Clone(req.Context())
+	redactHeaders(r.Header, redact)
+	dump, err := httputil.DumpRequest(r, false)
+	if err != nil {
+		return ""
+	}
+	return string(dump)
+}
+
+// redactHeaders hides the values of the headers named in redact
+func redactHeaders(header http.Header, redact []string) {
+	for _, name := range redact {
+		if header.Get(name) != "" {
+			header.Set(name, "[REDACTED]")
+		}
+	}
+}
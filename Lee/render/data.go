@@ -0,0 +1,23 @@
+package render
+
+import "net/http"
+
+// Data renders raw bytes. No Content-Type is set if ContentType is empty.
+type Data struct {
+	ContentType string
+	Data        []byte
+}
+
+// Render implements Render.
+func (r Data) Render(w http.ResponseWriter) error {
+	r.WriteContentType(w)
+	_, err := w.Write(r.Data)
+	return err
+}
+
+// WriteContentType implements Render.
+func (r Data) WriteContentType(w http.ResponseWriter) {
+	if r.ContentType != "" {
+		writeContentType(w, r.ContentType)
+	}
+}
@@ -0,0 +1,30 @@
+package render
+
+import (
+	"html/template"
+	"net/http"
+)
+
+// HTML renders the template Name of Template with Data. If Name is
+// empty, Template itself is executed.
+type HTML struct {
+	Template *template.Template
+	Name     string
+	Data     interface{}
+}
+
+const htmlContentType = "text/html"
+
+// Render implements Render.
+func (r HTML) Render(w http.ResponseWriter) error {
+	r.WriteContentType(w)
+	if r.Name == "" {
+		return r.Template.Execute(w, r.Data)
+	}
+	return r.Template.ExecuteTemplate(w, r.Name, r.Data)
+}
+
+// WriteContentType implements Render.
+func (r HTML) WriteContentType(w http.ResponseWriter) {
+	writeContentType(w, htmlContentType)
+}
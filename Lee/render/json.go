@@ -0,0 +1,194 @@
+package render
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"unicode/utf8"
+
+	"github.com/lpz1208/Lee/Lee/codec"
+)
+
+// JSON renders Data encoded as JSON, with HTML characters escaped.
+// A nil Codec means codec.StdJSON, which also applies to the variants below.
+type JSON struct {
+	Data  interface{}
+	Codec codec.JSON
+}
+
+// IndentedJSON renders Data as indented JSON.
+type IndentedJSON struct {
+	Data  interface{}
+	Codec codec.JSON
+}
+
+// PureJSON renders Data as JSON without escaping HTML characters.
+type PureJSON struct {
+	Data  interface{}
+	Codec codec.JSON
+}
+
+// SecureJSON renders Data as JSON, prefixing top-level arrays with
+// Prefix to prevent JSON hijacking.
+type SecureJSON struct {
+	Prefix string
+	Data   interface{}
+	Codec  codec.JSON
+}
+
+// AsciiJSON renders Data as JSON with all non-ASCII characters escaped.
+type AsciiJSON struct {
+	Data  interface{}
+	Codec codec.JSON
+}
+
+// JSONP renders Data as JSON wrapped in a call to Callback.
+type JSONP struct {
+	Callback string
+	Data     interface{}
+	Codec    codec.JSON
+}
+
+const (
+	jsonContentType       = "application/json"
+	javascriptContentType = "application/javascript; charset=utf-8"
+)
+
+// ErrInvalidCallback is returned when a JSONP callback is not a safe
+// JavaScript identifier.
+var ErrInvalidCallback = errors.New("render: invalid JSONP callback")
+
+// jsonpCallback only allows dotted identifiers such as jQuery123.cb
+var jsonpCallback = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*(\.[A-Za-z_$][A-Za-z0-9_$]*)*$`)
+
+// ValidCallback reports whether name can be used as a JSONP callback.
+func ValidCallback(name string) bool {
+	return len(name) <= 128 && jsonpCallback.MatchString(name)
+}
+
+func jsonCodec(c codec.JSON) codec.JSON {
+	if c == nil {
+		return codec.StdJSON
+	}
+	return c
+}
+
+// Render implements Render.
+func (r JSON) Render(w http.ResponseWriter) error {
+	r.WriteContentType(w)
+	return jsonCodec(r.Codec).NewEncoder(w).Encode(r.Data)
+}
+
+// WriteContentType implements Render.
+func (r JSON) WriteContentType(w http.ResponseWriter) {
+	writeContentType(w, jsonContentType)
+}
+
+// Render implements Render.
+func (r IndentedJSON) Render(w http.ResponseWriter) error {
+	r.WriteContentType(w)
+	bytes, err := jsonCodec(r.Codec).MarshalIndent(r.Data, "", "    ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(bytes)
+	return err
+}
+
+// WriteContentType implements Render.
+func (r IndentedJSON) WriteContentType(w http.ResponseWriter) {
+	writeContentType(w, jsonContentType)
+}
+
+// Render implements Render.
+func (r PureJSON) Render(w http.ResponseWriter) error {
+	r.WriteContentType(w)
+	encoder := jsonCodec(r.Codec).NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(r.Data)
+}
+
+// WriteContentType implements Render.
+func (r PureJSON) WriteContentType(w http.ResponseWriter) {
+	writeContentType(w, jsonContentType)
+}
+
+// Render implements Render.
+func (r SecureJSON) Render(w http.ResponseWriter) error {
+	r.WriteContentType(w)
+	data, err := jsonCodec(r.Codec).Marshal(r.Data)
+	if err != nil {
+		return err
+	}
+	if bytes.HasPrefix(data, []byte("[")) {
+		if _, err := w.Write([]byte(r.Prefix)); err != nil {
+			return err
+		}
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// WriteContentType implements Render.
+func (r SecureJSON) WriteContentType(w http.ResponseWriter) {
+	writeContentType(w, jsonContentType)
+}
+
+// Render implements Render.
+func (r AsciiJSON) Render(w http.ResponseWriter) error {
+	r.WriteContentType(w)
+	data, err := jsonCodec(r.Codec).Marshal(r.Data)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	for len(data) > 0 {
+		rn, size := utf8.DecodeRune(data)
+		data = data[size:]
+		switch {
+		case rn < utf8.RuneSelf:
+			buf.WriteByte(byte(rn))
+		case rn > 0xFFFF:
+			// characters outside the BMP are written as UTF-16 surrogate pairs
+			rn -= 0x10000
+			fmt.Fprintf(&buf, `\u%04x\u%04x`, 0xD800+(rn>>10), 0xDC00+(rn&0x3FF))
+		default:
+			fmt.Fprintf(&buf, `\u%04x`, rn)
+		}
+	}
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// WriteContentType implements Render.
+func (r AsciiJSON) WriteContentType(w http.ResponseWriter) {
+	writeContentType(w, jsonContentType)
+}
+
+// Render implements Render.
+func (r JSONP) Render(w http.ResponseWriter) error {
+	if !ValidCallback(r.Callback) {
+		return ErrInvalidCallback
+	}
+	r.WriteContentType(w)
+	data, err := jsonCodec(r.Codec).Marshal(r.Data)
+	if err != nil {
+		return err
+	}
+	// the leading comment defuses content sniffing attacks such as Rosetta Flash
+	var buf bytes.Buffer
+	buf.WriteString("/**/")
+	buf.WriteString(r.Callback)
+	buf.WriteByte('(')
+	buf.Write(data)
+	buf.WriteString(");")
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// WriteContentType implements Render.
+func (r JSONP) WriteContentType(w http.ResponseWriter) {
+	writeContentType(w, javascriptContentType)
+}
@@ -0,0 +1,32 @@
+package render
+
+import (
+	"net/http"
+
+	"github.com/ugorji/go/codec"
+)
+
+// MsgPack renders Data encoded as MessagePack.
+type MsgPack struct {
+	Data interface{}
+}
+
+const msgpackContentType = "application/msgpack"
+
+// msgpackHandle is safe for concurrent use once configured
+var msgpackHandle = func() *codec.MsgpackHandle {
+	h := &codec.MsgpackHandle{}
+	h.WriteExt = true
+	return h
+}()
+
+// Render implements Render.
+func (r MsgPack) Render(w http.ResponseWriter) error {
+	r.WriteContentType(w)
+	return codec.NewEncoder(w, msgpackHandle).Encode(r.Data)
+}
+
+// WriteContentType implements Render.
+func (r MsgPack) WriteContentType(w http.ResponseWriter) {
+	writeContentType(w, msgpackContentType)
+}
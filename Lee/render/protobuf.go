@@ -0,0 +1,31 @@
+package render
+
+import (
+	"net/http"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// ProtoBuf renders Data, which must be a proto.Message, in the
+// protocol buffers wire format.
+type ProtoBuf struct {
+	Data proto.Message
+}
+
+const protobufContentType = "application/x-protobuf"
+
+// Render implements Render.
+func (r ProtoBuf) Render(w http.ResponseWriter) error {
+	r.WriteContentType(w)
+	bytes, err := proto.Marshal(r.Data)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(bytes)
+	return err
+}
+
+// WriteContentType implements Render.
+func (r ProtoBuf) WriteContentType(w http.ResponseWriter) {
+	writeContentType(w, protobufContentType)
+}
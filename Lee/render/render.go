@@ -0,0 +1,22 @@
+// Package render contains the response renderers used by Lee.Context.
+//
+// Any type implementing Render can be passed to Context.Render, so other
+// packages can add output formats without changes to Lee.
+package render
+
+import "net/http"
+
+// Render is the interface implemented by response formats.
+type Render interface {
+	// Render writes the response body, setting Content-Type if it is unset.
+	Render(http.ResponseWriter) error
+	// WriteContentType sets the Content-Type header of the response.
+	WriteContentType(w http.ResponseWriter)
+}
+
+func writeContentType(w http.ResponseWriter, value string) {
+	header := w.Header()
+	if val := header["Content-Type"]; len(val) == 0 {
+		header["Content-Type"] = []string{value}
+	}
+}
@@ -0,0 +1,84 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/lpz1208/Lee/Lee/codec"
+)
+
+// SSEvent renders a server-sent event. Strings, byte slices and other
+// scalar values are sent as text, anything else is encoded as JSON.
+type SSEvent struct {
+	Event string
+	ID    string
+	// Retry tells the client how many milliseconds to wait before
+	// reconnecting, it is omitted when zero.
+	Retry int
+	Data  interface{}
+	Codec codec.JSON
+}
+
+const sseContentType = "text/event-stream"
+
+// fieldReplacer keeps single line fields from starting a new field
+var fieldReplacer = strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ")
+
+// lineReplacer turns the CRLF, CR and LF line breaks of the payload,
+// which are all line breaks to the client, into LF
+var lineReplacer = strings.NewReplacer("\r\n", "\n", "\r", "\n")
+
+// Render implements Render.
+func (r SSEvent) Render(w http.ResponseWriter) error {
+	r.WriteContentType(w)
+	var buf bytes.Buffer
+	if r.ID != "" {
+		buf.WriteString("id: " + fieldReplacer.Replace(r.ID) + "\n")
+	}
+	if r.Event != "" {
+		buf.WriteString("event: " + fieldReplacer.Replace(r.Event) + "\n")
+	}
+	if r.Retry > 0 {
+		buf.WriteString("retry: " + strconv.Itoa(r.Retry) + "\n")
+	}
+	data, err := r.data()
+	if err != nil {
+		return err
+	}
+	// every line of the payload needs its own data field
+	for _, line := range strings.Split(lineReplacer.Replace(data), "\n") {
+		buf.WriteString("data: " + line + "\n")
+	}
+	buf.WriteByte('\n')
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+func (r SSEvent) data() (string, error) {
+	switch data := r.Data.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return data, nil
+	case []byte:
+		return string(data), nil
+	case fmt.Stringer:
+		return data.String(), nil
+	case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return fmt.Sprint(data), nil
+	}
+	bytes, err := jsonCodec(r.Codec).Marshal(r.Data)
+	return string(bytes), err
+}
+
+// WriteContentType implements Render.
+func (r SSEvent) WriteContentType(w http.ResponseWriter) {
+	header := w.Header()
+	writeContentType(w, sseContentType)
+	if header.Get("Cache-Control") == "" {
+		header.Set("Cache-Control", "no-cache")
+	}
+}
@@ -0,0 +1,26 @@
+package render
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// String renders a formatted plain text response.
+type String struct {
+	Format string
+	Data   []interface{}
+}
+
+const plainContentType = "text/plain"
+
+// Render implements Render.
+func (r String) Render(w http.ResponseWriter) error {
+	r.WriteContentType(w)
+	_, err := fmt.Fprintf(w, r.Format, r.Data...)
+	return err
+}
+
+// WriteContentType implements Render.
+func (r String) WriteContentType(w http.ResponseWriter) {
+	writeContentType(w, plainContentType)
+}
@@ -0,0 +1,30 @@
+package render
+
+import (
+	"net/http"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// TOML renders Data encoded as TOML.
+type TOML struct {
+	Data interface{}
+}
+
+const tomlContentType = "application/toml; charset=utf-8"
+
+// Render implements Render.
+func (r TOML) Render(w http.ResponseWriter) error {
+	r.WriteContentType(w)
+	bytes, err := toml.Marshal(r.Data)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(bytes)
+	return err
+}
+
+// WriteContentType implements Render.
+func (r TOML) WriteContentType(w http.ResponseWriter) {
+	writeContentType(w, tomlContentType)
+}
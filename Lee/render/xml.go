@@ -0,0 +1,44 @@
+package render
+
+import (
+	"encoding/xml"
+	"net/http"
+	"reflect"
+)
+
+// XML renders Data encoded as XML. Values of unnamed struct types,
+// which have no element name of their own, are encoded as <response>.
+type XML struct {
+	Data interface{}
+}
+
+const xmlContentType = "application/xml; charset=utf-8"
+
+// Render implements Render.
+func (r XML) Render(w http.ResponseWriter) error {
+	r.WriteContentType(w)
+	enc := xml.NewEncoder(w)
+	if needsRootElement(r.Data) {
+		return enc.EncodeElement(r.Data, xml.StartElement{Name: xml.Name{Local: "response"}})
+	}
+	return enc.Encode(r.Data)
+}
+
+// WriteContentType implements Render.
+func (r XML) WriteContentType(w http.ResponseWriter) {
+	writeContentType(w, xmlContentType)
+}
+
+// needsRootElement reports whether v is an unnamed struct without an
+// XMLName field
+func needsRootElement(v interface{}) bool {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct || t.Name() != "" {
+		return false
+	}
+	_, ok := t.FieldByName("XMLName")
+	return !ok
+}
@@ -0,0 +1,30 @@
+package render
+
+import (
+	"net/http"
+
+	"github.com/goccy/go-yaml"
+)
+
+// YAML renders Data encoded as YAML.
+type YAML struct {
+	Data interface{}
+}
+
+const yamlContentType = "application/yaml; charset=utf-8"
+
+// Render implements Render.
+func (r YAML) Render(w http.ResponseWriter) error {
+	r.WriteContentType(w)
+	bytes, err := yaml.Marshal(r.Data)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(bytes)
+	return err
+}
+
+// WriteContentType implements Render.
+func (r YAML) WriteContentType(w http.ResponseWriter) {
+	writeContentType(w, yamlContentType)
+}
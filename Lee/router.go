@@ -120,8 +120,13 @@ func (r *router) handle(c *Context) {
 	if n != nil {
 		key := c.Method + "-" + n.pattern
 		c.Params = params
+		c.fullPath = n.pattern
+		if IsDebugging() {
+			c.Writer.Header().Set("X-Lee-Route", key)
+		}
 		c.handlers = append(c.handlers, r.handlers[key])
 	} else {
+		c.fullPath = ""
 		c.handlers = append(c.handlers, func(c *Context) {
 			c.String(http.StatusNotFound, "404 NOT FOUND: %s\n", c.Path)
 		})
@@ -0,0 +1,284 @@
+package Lee
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// ServerOptions configures the http.Server built by Engine.Server. Zero
+// values get the defaults below, negative timeouts disable them.
+type ServerOptions struct {
+	Addr string
+	// ReadHeaderTimeout bounds reading the request headers, so slow
+	// clients can't hold connections open. 10 seconds by default.
+	ReadHeaderTimeout time.Duration
+	// ReadTimeout bounds reading the whole request. None by default, see
+	// RouterGroup.SetReadTimeout for per group limits.
+	ReadTimeout time.Duration
+	// WriteTimeout bounds writing the response. None by default, so
+	// streams and downloads are not cut off.
+	WriteTimeout time.Duration
+	// IdleTimeout bounds waiting for the next request on a keep-alive
+	// connection. 2 minutes by default.
+	IdleTimeout time.Duration
+	// MaxHeaderBytes limits the size of the request headers, 1MB by
+	// default.
+	MaxHeaderBytes int
+	// ErrorLog receives connection errors, by default the logger of the
+	// engine at the error level.
+	ErrorLog *log.Logger
+	// UnixSocketMode is the permission of sockets created by RunUnix,
+	// 0660 by default.
+	UnixSocketMode os.FileMode
+	// H2C serves HTTP/2 without TLS, to clients with prior knowledge and
+	// to those asking for an upgrade. The first request of an upgraded
+	// connection is read into memory, so set a body limit.
+	H2C bool
+}
+
+// shutdowner is a server stopped by Engine.Shutdown
+type shutdowner interface {
+	Shutdown(ctx context.Context) error
+}
+
+// serverState tracks the servers of an engine for Shutdown
+type serverState struct {
+	mu      sync.Mutex
+	servers []shutdowner
+	hooks   []func()
+	timeout time.Duration
+	options ServerOptions
+}
+
+func timeoutOption(d, def time.Duration) time.Duration {
+	switch {
+	case d == 0:
+		return def
+	case d < 0:
+		return 0
+	}
+	return d
+}
+
+// Server returns an http.Server serving the engine with opts, which may
+// be nil. It is stopped by Shutdown along with the servers of Run.
+func (engine *Engine) Server(opts *ServerOptions) *http.Server {
+	if opts == nil {
+		opts = &ServerOptions{}
+	}
+	srv := &http.Server{
+		Addr:              opts.Addr,
+		Handler:           engine,
+		ReadHeaderTimeout: timeoutOption(opts.ReadHeaderTimeout, 10*time.Second),
+		ReadTimeout:       timeoutOption(opts.ReadTimeout, 0),
+		WriteTimeout:      timeoutOption(opts.WriteTimeout, 0),
+		IdleTimeout:       timeoutOption(opts.IdleTimeout, 2*time.Minute),
+		MaxHeaderBytes:    opts.MaxHeaderBytes,
+		ErrorLog:          opts.ErrorLog,
+	}
+	if srv.ErrorLog == nil {
+		srv.ErrorLog = slog.NewLogLogger(engine.log().Handler(), slog.LevelError)
+	}
+	if srv.MaxHeaderBytes <= 0 {
+		srv.MaxHeaderBytes = http.DefaultMaxHeaderBytes
+	}
+	if opts.H2C {
+		srv.Handler = h2c.NewHandler(engine, &http2.Server{IdleTimeout: srv.IdleTimeout})
+	}
+	engine.track(srv)
+	return srv
+}
+
+// track registers a server for Shutdown
+func (engine *Engine) track(srv shutdowner) {
+	engine.server.mu.Lock()
+	engine.server.servers = append(engine.server.servers, srv)
+	engine.server.mu.Unlock()
+}
+
+// SetServerOptions sets the options of the servers started by the Run
+// methods.
+func (engine *Engine) SetServerOptions(opts ServerOptions) {
+	engine.server.mu.Lock()
+	engine.server.options = opts
+	engine.server.mu.Unlock()
+}
+
+// serverOptions returns the options of SetServerOptions for addr
+func (engine *Engine) serverOptions(addr string) ServerOptions {
+	engine.server.mu.Lock()
+	opts := engine.server.options
+	engine.server.mu.Unlock()
+	opts.Addr = addr
+	return opts
+}
+
+// newServer builds a server with the options of SetServerOptions
+func (engine *Engine) newServer(addr string) *http.Server {
+	opts := engine.serverOptions(addr)
+	return engine.Server(&opts)
+}
+
+// OnShutdown registers hooks run by Shutdown once in-flight requests are
+// done, for example to close database connections.
+func (engine *Engine) OnShutdown(hooks ...func()) {
+	engine.server.mu.Lock()
+	engine.server.hooks = append(engine.server.hooks, hooks...)
+	engine.server.mu.Unlock()
+}
+
+// SetShutdownTimeout sets how long RunWithContext waits for in-flight
+// requests when it stops, 30 seconds by default.
+func (engine *Engine) SetShutdownTimeout(d time.Duration) {
+	engine.server.timeout = d
+}
+
+// Shutdown gracefully stops the servers of the engine: they stop
+// accepting connections and in-flight requests are waited for, until ctx
+// is done. The OnShutdown hooks run afterwards, once.
+func (engine *Engine) Shutdown(ctx context.Context) error {
+	engine.server.mu.Lock()
+	servers, hooks := engine.server.servers, engine.server.hooks
+	engine.server.servers, engine.server.hooks = nil, nil
+	engine.server.mu.Unlock()
+
+	errs := make([]error, len(servers))
+	var wg sync.WaitGroup
+	for i, srv := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = srv.Shutdown(ctx)
+		}()
+	}
+	wg.Wait()
+	for _, hook := range hooks {
+		hook()
+	}
+	return errors.Join(errs...)
+}
+
+// Run defines the method to start a http server
+func (engine *Engine) Run(addr string) (err error) {
+	return engine.newServer(addr).ListenAndServe()
+}
+
+// RunTLS serves HTTPS on addr with the given certificate and key files.
+func (engine *Engine) RunTLS(addr, certFile, keyFile string) error {
+	return engine.newServer(addr).ListenAndServeTLS(certFile, keyFile)
+}
+
+// RunListener serves on an existing listener.
+func (engine *Engine) RunListener(ln net.Listener) error {
+	return engine.newServer(ln.Addr().String()).Serve(ln)
+}
+
+// RunFd serves on an inherited listening socket, for example one passed
+// by systemd socket activation, where the first socket is fd 3.
+func (engine *Engine) RunFd(fd int) error {
+	f := os.NewFile(uintptr(fd), fmt.Sprintf("fd%d", fd))
+	ln, err := net.FileListener(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	return engine.RunListener(ln)
+}
+
+// RunUnix serves on a unix socket at path. A stale socket left by a
+// previous process is removed, and the socket is removed again when the
+// server stops.
+func (engine *Engine) RunUnix(path string) error {
+	if err := removeStaleSocket(path); err != nil {
+		return err
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+
+	mode := engine.serverOptions(path).UnixSocketMode
+	if mode == 0 {
+		mode = 0o660
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		return err
+	}
+	return engine.newServer(path).Serve(ln)
+}
+
+// removeStaleSocket removes the socket at path unless a server still
+// listens on it. Other files are left alone.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("Lee: %s exists and is not a socket", path)
+	}
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("Lee: %s is in use", path)
+	}
+	return os.Remove(path)
+}
+
+// RunWithContext serves on addr until ctx is done, then shuts the engine
+// down gracefully. It returns nil after a graceful shutdown.
+func (engine *Engine) RunWithContext(ctx context.Context, addr string) error {
+	return engine.runServer(ctx, engine.newServer(addr).ListenAndServe)
+}
+
+// RunGraceful serves on addr until the process receives SIGINT or
+// SIGTERM, then shuts the engine down gracefully.
+func (engine *Engine) RunGraceful(addr string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return engine.RunWithContext(ctx, addr)
+}
+
+// runServer runs serve until it fails or ctx is done
+func (engine *Engine) runServer(ctx context.Context, serve func() error) error {
+	errc := make(chan error, 1)
+	go func() { errc <- serve() }()
+	select {
+	case err := <-errc:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	case <-ctx.Done():
+	}
+
+	timeout := engine.server.timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := engine.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
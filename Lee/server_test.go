@@ -0,0 +1,368 @@
+package Lee
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+	"golang.org/x/net/http2"
+)
+
+// selfSignedCert writes a certificate for 127.0.0.1 and its key to dir
+func selfSignedCert(t *testing.T, dir string) (certFile, keyFile string, pool *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600)
+	cert, _ := x509.ParseCertificate(der)
+	pool = x509.NewCertPool()
+	pool.AddCert(cert)
+	return certFile, keyFile, pool
+}
+
+// freeAddr returns a loopback address nothing listens on
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+// getUntilUp retries a request while the server is starting
+func getUntilUp(t *testing.T, client *http.Client, url string) string {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		resp, err := client.Get(url)
+		if err == nil {
+			b, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			return string(b)
+		}
+		if time.Now().After(deadline) {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// runEngine runs serve and shuts the engine down when the test ends
+func runEngine(t *testing.T, r *Engine, serve func() error) {
+	t.Helper()
+	done := make(chan error, 1)
+	go func() { done <- serve() }()
+	t.Cleanup(func() {
+		r.Shutdown(context.Background())
+		if err := <-done; err != http.ErrServerClosed {
+			t.Errorf("server stopped with %v", err)
+		}
+	})
+}
+
+func TestServerOptions(t *testing.T) {
+	r := New()
+	srv := r.Server(&ServerOptions{Addr: ":8080", WriteTimeout: -1, ReadTimeout: time.Second})
+	if srv.Addr != ":8080" || srv.Handler != r {
+		t.Fatal("server not bound to the engine")
+	}
+	if srv.ReadHeaderTimeout != 10*time.Second || srv.ReadTimeout != time.Second ||
+		srv.WriteTimeout != 0 || srv.IdleTimeout != 2*time.Minute {
+		t.Fatalf("unexpected timeouts %+v", srv)
+	}
+	if srv.MaxHeaderBytes != http.DefaultMaxHeaderBytes {
+		t.Fatalf("MaxHeaderBytes %d", srv.MaxHeaderBytes)
+	}
+
+	// connection errors go to the logger of the engine
+	var out strings.Builder
+	r.SetLogger(slog.New(slog.NewTextHandler(&out, nil)))
+	r.Server(nil).ErrorLog.Print("http: TLS handshake error")
+	if !strings.Contains(out.String(), `level=ERROR msg="http: TLS handshake error"`) {
+		t.Fatalf("ErrorLog: %q", out.String())
+	}
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	r := New()
+	started, release := make(chan struct{}), make(chan struct{})
+	var requestDone, hookRan atomic.Bool
+	r.GET("/slow", func(c *Context) {
+		close(started)
+		<-release
+		c.String(http.StatusOK, "done")
+		requestDone.Store(true)
+	})
+	r.OnShutdown(func() { hookRan.Store(requestDone.Load()) })
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	srv := r.Server(nil)
+	go srv.Serve(ln)
+
+	body := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + addr + "/slow")
+		if err != nil {
+			body <- err.Error()
+			return
+		}
+		b, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		body <- string(b)
+	}()
+	<-started
+
+	shutdownErr := make(chan error, 1)
+	go func() { shutdownErr <- r.Shutdown(context.Background()) }()
+	// new connections are refused while the request is in flight
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			break
+		}
+		conn.Close()
+		if time.Now().After(deadline) {
+			t.Fatal("listener still accepting after Shutdown")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case err := <-shutdownErr:
+		t.Fatalf("Shutdown returned before the request finished: %v", err)
+	default:
+	}
+
+	close(release)
+	if b := <-body; b != "done" {
+		t.Fatalf("in-flight request got %q", b)
+	}
+	if err := <-shutdownErr; err != nil {
+		t.Fatal(err)
+	}
+	if !hookRan.Load() {
+		t.Fatal("OnShutdown hook should run after in-flight requests")
+	}
+}
+
+func TestRunWithContext(t *testing.T) {
+	r := New()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- r.RunWithContext(ctx, "127.0.0.1:0") }()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("RunWithContext did not stop")
+	}
+
+	if err := r.RunWithContext(context.Background(), "bad address"); err == nil {
+		t.Fatal("listen errors should be returned")
+	}
+}
+
+func TestRunEntryPoints(t *testing.T) {
+	newEngine := func() *Engine {
+		r := New()
+		r.GET("/ping", func(c *Context) { c.String(http.StatusOK, "pong") })
+		return r
+	}
+	dir := t.TempDir()
+
+	t.Run("TLS", func(t *testing.T) {
+		r := newEngine()
+		certFile, keyFile, pool := selfSignedCert(t, dir)
+		addr := freeAddr(t)
+		runEngine(t, r, func() error { return r.RunTLS(addr, certFile, keyFile) })
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+		if body := getUntilUp(t, client, "https://"+addr+"/ping"); body != "pong" {
+			t.Fatalf("unexpected body %q", body)
+		}
+	})
+
+	t.Run("Listener", func(t *testing.T) {
+		r := newEngine()
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		runEngine(t, r, func() error { return r.RunListener(ln) })
+		if body := getUntilUp(t, http.DefaultClient, "http://"+ln.Addr().String()+"/ping"); body != "pong" {
+			t.Fatalf("unexpected body %q", body)
+		}
+	})
+
+	t.Run("Fd", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("file listeners are not supported on windows")
+		}
+		r := newEngine()
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := ln.(*net.TCPListener).File()
+		ln.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		runEngine(t, r, func() error { return r.RunFd(int(f.Fd())) })
+		if body := getUntilUp(t, http.DefaultClient, "http://"+ln.Addr().String()+"/ping"); body != "pong" {
+			t.Fatalf("unexpected body %q", body)
+		}
+	})
+
+	t.Run("Unix", func(t *testing.T) {
+		r := newEngine()
+		r.SetServerOptions(ServerOptions{UnixSocketMode: 0o600})
+		path := filepath.Join(dir, "lee.sock")
+		// a socket left behind by a crashed process
+		stale, err := net.Listen("unix", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stale.(*net.UnixListener).SetUnlinkOnClose(false)
+		stale.Close()
+
+		runEngine(t, r, func() error { return r.RunUnix(path) })
+		client := &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			},
+		}}
+		if body := getUntilUp(t, client, "http://unix/ping"); body != "pong" {
+			t.Fatalf("unexpected body %q", body)
+		}
+		if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+			t.Fatalf("socket mode: %v %v", info.Mode(), err)
+		}
+		// a live socket is not taken over
+		if err := New().RunUnix(path); err == nil {
+			t.Fatal("RunUnix should refuse a socket in use")
+		}
+	})
+
+	if _, err := os.Stat(filepath.Join(dir, "lee.sock")); !os.IsNotExist(err) {
+		t.Fatal("socket should be removed after shutdown")
+	}
+}
+
+func TestH2C(t *testing.T) {
+	r := New()
+	r.GET("/proto", func(c *Context) { c.String(http.StatusOK, c.Req.Proto) })
+	r.SetServerOptions(ServerOptions{H2C: true})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	runEngine(t, r, func() error { return r.RunListener(ln) })
+	url := "http://" + ln.Addr().String() + "/proto"
+
+	// prior knowledge
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}}
+	if body := getUntilUp(t, client, url); body != "HTTP/2.0" {
+		t.Fatalf("prior knowledge: %q", body)
+	}
+
+	// upgrade from HTTP/1.1
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	io.WriteString(conn, "GET /proto HTTP/1.1\r\nHost: test\r\nConnection: Upgrade, HTTP2-Settings\r\n"+
+		"Upgrade: h2c\r\nHTTP2-Settings: AAMAAABkAAQAAP__\r\n\r\n")
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	status := make([]byte, len("HTTP/1.1 101"))
+	if _, err := io.ReadFull(conn, status); err != nil || string(status) != "HTTP/1.1 101" {
+		t.Fatalf("upgrade: %q %v", status, err)
+	}
+
+	// plain HTTP/1.1 still works
+	if body := getUntilUp(t, http.DefaultClient, url); body != "HTTP/1.1" {
+		t.Fatalf("http/1.1: %q", body)
+	}
+}
+
+func TestRunQUIC(t *testing.T) {
+	r := New()
+	r.GET("/proto", func(c *Context) { c.String(http.StatusOK, c.Req.Proto) })
+	certFile, keyFile, pool := selfSignedCert(t, t.TempDir())
+	addr := freeAddr(t)
+	runEngine(t, r, func() error { return r.RunQUIC(addr, certFile, keyFile) })
+
+	tlsConfig := &tls.Config{RootCAs: pool}
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	getUntilUp(t, client, "https://"+addr+"/proto")
+	resp, err := client.Get("https://" + addr + "/proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	_, port, _ := net.SplitHostPort(addr)
+	if altSvc := resp.Header.Get("Alt-Svc"); !strings.Contains(altSvc, `h3=":`+port+`"`) {
+		t.Fatalf("Alt-Svc %q", altSvc)
+	}
+
+	h3 := &http3.Transport{TLSClientConfig: tlsConfig}
+	defer h3.Close()
+	if body := getUntilUp(t, &http.Client{Transport: h3}, "https://"+addr+"/proto"); body != "HTTP/3.0" {
+		t.Fatalf("http/3: %q", body)
+	}
+}
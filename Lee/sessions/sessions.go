@@ -0,0 +1,320 @@
+// Package sessions provides server-side sessions for Lee.
+//
+// Session values are kept either in a signed cookie (the default, which
+// requires Engine.SetCookieKeys) or in a Store, with only a random session
+// id sent to the client. Values are encoded with encoding/gob, so custom
+// types stored in a session must be registered with gob.Register.
+package sessions
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/lpz1208/Lee/Lee"
+)
+
+const (
+	contextKey = "github.com/lpz1208/Lee/sessions"
+	flashKey   = "_flash"
+	// browsers drop cookies larger than this
+	maxCookieSize = 4096
+)
+
+// ErrCookieTooLarge is returned by Save when the values of a cookie
+// session do not fit in a cookie.
+var ErrCookieTooLarge = errors.New("sessions: encoded session exceeds cookie size limit")
+
+func init() {
+	// flash messages are stored as a slice inside the values
+	gob.Register([]interface{}{})
+}
+
+// Config configures the Sessions middleware.
+type Config struct {
+	// Name of the session cookie, "session" by default.
+	Name string
+	// Store keeps session values on the server. If nil, values are
+	// stored in a signed cookie.
+	Store Store
+	// IdleTimeout is how long a session lives without being used,
+	// 30 minutes by default. Every use extends it, for cookie sessions
+	// by setting the cookie again.
+	IdleTimeout time.Duration
+	// Cookie holds the attributes of the session cookie. HttpOnly is
+	// always set.
+	Cookie Lee.CookieOptions
+}
+
+// State holds the values of the current client's session.
+type State struct {
+	c         *Lee.Context
+	config    *Config
+	id        string
+	values    map[string]interface{}
+	loaded    bool
+	dirty     bool
+	saved     bool
+	destroyed bool
+}
+
+// cookieSession is the payload of a session stored in a cookie
+type cookieSession struct {
+	Expires time.Time
+	Values  map[string]interface{}
+}
+
+// Sessions returns a middleware which makes the session of the request
+// available through Session.
+func Sessions(config Config) Lee.HandlerFunc {
+	if config.Name == "" {
+		config.Name = "session"
+	}
+	if config.IdleTimeout <= 0 {
+		config.IdleTimeout = 30 * time.Minute
+	}
+	config.Cookie.HttpOnly = true
+	return func(c *Lee.Context) {
+		s := &State{c: c, config: &config}
+		c.Set(contextKey, s)
+		c.Next()
+		s.touch()
+	}
+}
+
+// Session returns the session of the request. It panics if the Sessions
+// middleware is not installed.
+func Session(c *Lee.Context) *State {
+	s, ok := c.Get(contextKey)
+	if !ok {
+		panic("sessions: Sessions middleware is not installed")
+	}
+	return s.(*State)
+}
+
+func (s *State) load() {
+	if s.loaded {
+		return
+	}
+	s.loaded = true
+	s.values = make(map[string]interface{})
+	if s.config.Store == nil {
+		s.loadCookie()
+		return
+	}
+	id, err := s.c.Cookie(s.config.Name)
+	if err != nil || !validID(id) {
+		return
+	}
+	values, err := s.config.Store.Load(id)
+	if err != nil {
+		return
+	}
+	s.id = id
+	s.values = values
+}
+
+func (s *State) loadCookie() {
+	raw, err := s.c.SignedCookie(s.config.Name)
+	if err != nil {
+		return
+	}
+	var cs cookieSession
+	if err := gob.NewDecoder(strings.NewReader(raw)).Decode(&cs); err != nil {
+		return
+	}
+	if time.Now().After(cs.Expires) || cs.Values == nil {
+		return
+	}
+	s.values = cs.Values
+	// the session is used, so its cookie is issued again with a new expiry
+	s.writeCookie()
+}
+
+// ID returns the session id, which is empty for cookie sessions and
+// for new sessions that have not been saved yet.
+func (s *State) ID() string {
+	s.load()
+	return s.id
+}
+
+// Get returns the value stored for key.
+func (s *State) Get(key string) interface{} {
+	s.load()
+	return s.values[key]
+}
+
+// Set stores a value in the session.
+func (s *State) Set(key string, value interface{}) {
+	s.load()
+	s.values[key] = value
+	s.dirty = true
+}
+
+// Delete removes a value from the session.
+func (s *State) Delete(key string) {
+	s.load()
+	delete(s.values, key)
+	s.dirty = true
+}
+
+// Flash adds a message that is returned once by Flashes, usually
+// on the next request.
+func (s *State) Flash(value interface{}) {
+	s.load()
+	flashes, _ := s.values[flashKey].([]interface{})
+	s.values[flashKey] = append(flashes, value)
+	s.dirty = true
+}
+
+// Flashes returns and clears the flash messages of the session.
+func (s *State) Flashes() []interface{} {
+	s.load()
+	flashes, _ := s.values[flashKey].([]interface{})
+	if flashes != nil {
+		delete(s.values, flashKey)
+		s.dirty = true
+	}
+	return flashes
+}
+
+// Save writes the session and sets the session cookie. It must be
+// called before the response is written.
+func (s *State) Save() error {
+	s.load()
+	if s.config.Store == nil {
+		return s.saveCookie()
+	}
+	if s.id == "" {
+		id, err := newID()
+		if err != nil {
+			return err
+		}
+		s.id = id
+	}
+	if err := s.config.Store.Save(s.id, s.values, s.config.IdleTimeout); err != nil {
+		return err
+	}
+	s.c.SetCookie(s.config.Name, s.id, s.config.Cookie)
+	s.dirty = false
+	s.saved = true
+	s.destroyed = false
+	return nil
+}
+
+func (s *State) saveCookie() error {
+	if err := s.writeCookie(); err != nil {
+		return err
+	}
+	s.dirty = false
+	s.saved = true
+	s.destroyed = false
+	return nil
+}
+
+// writeCookie sets the cookie holding the values, expiring after the
+// idle timeout
+func (s *State) writeCookie() error {
+	var buf bytes.Buffer
+	cs := cookieSession{Expires: time.Now().Add(s.config.IdleTimeout), Values: s.values}
+	if err := gob.NewEncoder(&buf).Encode(&cs); err != nil {
+		return err
+	}
+	// the length of the value set by SetSignedCookie: payload "." MAC
+	size := base64.RawURLEncoding.EncodedLen(buf.Len()) + 1 + base64.RawURLEncoding.EncodedLen(sha256.Size)
+	if size > maxCookieSize {
+		return ErrCookieTooLarge
+	}
+	s.dropCookie()
+	return s.c.SetSignedCookie(s.config.Name, buf.String(), s.config.Cookie)
+}
+
+// dropCookie removes the session cookie set earlier during the request,
+// so that only the last one is sent
+func (s *State) dropCookie() {
+	header := s.c.Writer.Header()
+	prefix := s.config.Name + "="
+	var kept []string
+	for _, line := range header.Values("Set-Cookie") {
+		if !strings.HasPrefix(line, prefix) {
+			kept = append(kept, line)
+		}
+	}
+	header.Del("Set-Cookie")
+	for _, line := range kept {
+		header.Add("Set-Cookie", line)
+	}
+}
+
+// Regenerate moves the session to a new id, keeping its values, and
+// saves it. The old id stops working.
+func (s *State) Regenerate() error {
+	s.load()
+	if s.config.Store != nil && s.id != "" {
+		if err := s.config.Store.Delete(s.id); err != nil {
+			return err
+		}
+		s.id = ""
+	}
+	return s.Save()
+}
+
+// Login regenerates the session and stores value for key, which
+// prevents session fixation when a user signs in.
+func (s *State) Login(key string, value interface{}) error {
+	s.Set(key, value)
+	return s.Regenerate()
+}
+
+// Destroy deletes the session and expires the session cookie.
+func (s *State) Destroy() error {
+	s.load()
+	if s.config.Store != nil && s.id != "" {
+		if err := s.config.Store.Delete(s.id); err != nil {
+			return err
+		}
+	}
+	s.id = ""
+	s.values = make(map[string]interface{})
+	s.dirty = false
+	s.destroyed = true
+	opts := s.config.Cookie
+	opts.MaxAge = -1
+	s.dropCookie()
+	s.c.SetCookie(s.config.Name, "", opts)
+	return nil
+}
+
+// touch extends the idle timeout of an unchanged server-side session
+// that was used during the request. Cookie sessions are issued again
+// when they are loaded, as the response may be written by now.
+func (s *State) touch() {
+	if s.config.Store == nil || !s.loaded || s.saved || s.dirty || s.destroyed || s.id == "" {
+		return
+	}
+	s.config.Store.Save(s.id, s.values, s.config.IdleTimeout)
+}
+
+func newID() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// validID reports whether id looks like an id created by newID, which
+// also keeps ids from the client safe to use as file names
+func validID(id string) bool {
+	if len(id) != 64 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
@@ -0,0 +1,182 @@
+package sessions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lpz1208/Lee/Lee"
+)
+
+func newTestEngine(config Config) *Lee.Engine {
+	r := Lee.New()
+	r.SetCookieKeys([]byte("0123456789abcdef0123456789abcdef"))
+	r.Use(Sessions(config))
+	r.GET("/login", func(c *Lee.Context) {
+		s := Session(c)
+		if err := s.Login("user", "alice"); err != nil {
+			c.Fail(http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.Flash("welcome")
+		s.Save()
+		c.String(http.StatusOK, "%s", s.ID())
+	})
+	r.GET("/me", func(c *Lee.Context) {
+		s := Session(c)
+		user, _ := s.Get("user").(string)
+		flashes := s.Flashes()
+		s.Save()
+		c.String(http.StatusOK, "%s %v", user, flashes)
+	})
+	r.GET("/logout", func(c *Lee.Context) {
+		Session(c).Destroy()
+		c.String(http.StatusOK, "bye")
+	})
+	return r
+}
+
+func do(r *Lee.Engine, path string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", path, nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// lastCookies keeps the last Set-Cookie for each name, like a browser
+func lastCookies(w *httptest.ResponseRecorder) []*http.Cookie {
+	byName := map[string]*http.Cookie{}
+	for _, cookie := range w.Result().Cookies() {
+		byName[cookie.Name] = cookie
+	}
+	var cookies []*http.Cookie
+	for _, cookie := range byName {
+		if cookie.MaxAge >= 0 {
+			cookies = append(cookies, cookie)
+		}
+	}
+	return cookies
+}
+
+func TestSessionStores(t *testing.T) {
+	fileStore, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stores := map[string]Store{
+		"cookie": nil,
+		"memory": NewMemoryStore(),
+		"file":   fileStore,
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			r := newTestEngine(Config{Store: store})
+			w := do(r, "/login", nil)
+			cookies := lastCookies(w)
+			if len(cookies) != 1 {
+				t.Fatalf("expected one session cookie, got %v", w.Result().Cookies())
+			}
+
+			w = do(r, "/me", cookies)
+			if body := w.Body.String(); body != "alice [welcome]" {
+				t.Fatalf("first visit: %q", body)
+			}
+			if updated := lastCookies(w); len(updated) > 0 {
+				cookies = updated
+			}
+			// flashes are only returned once
+			if body := do(r, "/me", cookies).Body.String(); body != "alice []" {
+				t.Fatalf("second visit: %q", body)
+			}
+
+			do(r, "/logout", cookies)
+			if store != nil {
+				if body := do(r, "/me", cookies).Body.String(); body != " []" {
+					t.Fatalf("destroyed session still valid: %q", body)
+				}
+			}
+		})
+	}
+}
+
+func TestSessionSurvivesForward(t *testing.T) {
+	r := newTestEngine(Config{Store: NewMemoryStore()})
+	r.GET("/forward", func(c *Lee.Context) {
+		Session(c).Set("user", "bob")
+		c.Forward("/me")
+	})
+	if body := do(r, "/forward", nil).Body.String(); body != "bob []" {
+		t.Fatalf("session lost on forward: %q", body)
+	}
+}
+
+func TestRegenerateOnLogin(t *testing.T) {
+	store := NewMemoryStore()
+	r := newTestEngine(Config{Store: store})
+	first := lastCookies(do(r, "/login", nil))
+	second := lastCookies(do(r, "/login", first))
+	if first[0].Value == second[0].Value {
+		t.Fatal("login should move the session to a new id")
+	}
+	if _, err := store.Load(first[0].Value); err != ErrNotFound {
+		t.Fatal("old session id should be deleted")
+	}
+}
+
+func TestMemoryStoreExpiry(t *testing.T) {
+	store := NewMemoryStore()
+	id, _ := newID()
+	store.Save(id, map[string]interface{}{"a": 1}, 10*time.Millisecond)
+	if _, err := store.Load(id); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, err := store.Load(id); err != ErrNotFound {
+		t.Fatalf("expected expired session, got %v", err)
+	}
+}
+
+func TestCookieSessionIdleTimeout(t *testing.T) {
+	r := newTestEngine(Config{IdleTimeout: 300 * time.Millisecond})
+	r.GET("/peek", func(c *Lee.Context) {
+		user, _ := Session(c).Get("user").(string)
+		c.String(http.StatusOK, "%s", user)
+	})
+	cookies := lastCookies(do(r, "/login", nil))
+	// each use issues the cookie again, so the session outlives a
+	// single idle timeout while it is used
+	for i := 0; i < 2; i++ {
+		time.Sleep(200 * time.Millisecond)
+		w := do(r, "/peek", cookies)
+		if w.Body.String() != "alice" {
+			t.Fatalf("visit %d: %q", i, w.Body.String())
+		}
+		if cookies = lastCookies(w); len(w.Result().Cookies()) != 1 {
+			t.Fatalf("visit %d: expected one refreshed cookie, got %v", i, w.Result().Cookies())
+		}
+	}
+	time.Sleep(400 * time.Millisecond)
+	if body := do(r, "/peek", cookies).Body.String(); body != "" {
+		t.Fatalf("idle session still valid: %q", body)
+	}
+}
+
+func TestCookieSessionTooLarge(t *testing.T) {
+	r := newTestEngine(Config{})
+	r.GET("/big", func(c *Lee.Context) {
+		s := Session(c)
+		// fits the limit before signing, but not the signed cookie
+		s.Set("blob", strings.Repeat("x", 3000))
+		if err := s.Save(); err != ErrCookieTooLarge {
+			t.Errorf("Save: %v", err)
+		}
+	})
+	if w := do(r, "/big", nil); len(w.Result().Cookies()) != 0 {
+		t.Fatalf("oversized cookie was set: %d bytes", len(w.Header().Get("Set-Cookie")))
+	}
+}
@@ -0,0 +1,218 @@
+package sessions
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned by Store.Load for unknown or expired sessions.
+var ErrNotFound = errors.New("sessions: session not found")
+
+// gcInterval is how often stores sweep expired sessions
+const gcInterval = time.Minute
+
+// Store keeps session values on the server.
+type Store interface {
+	// Load returns the values of the session, or ErrNotFound.
+	Load(id string) (map[string]interface{}, error)
+	// Save stores the values of the session, which expires if it is
+	// not saved again within ttl.
+	Save(id string, values map[string]interface{}, ttl time.Duration) error
+	// Delete removes the session.
+	Delete(id string) error
+}
+
+type memoryEntry struct {
+	values  map[string]interface{}
+	expires time.Time
+}
+
+// MemoryStore is a Store keeping sessions in process memory.
+type MemoryStore struct {
+	mu       sync.Mutex
+	sessions map[string]memoryEntry
+	lastGC   time.Time
+}
+
+// NewMemoryStore is the constructor of MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{sessions: make(map[string]memoryEntry), lastGC: time.Now()}
+}
+
+func copyValues(values map[string]interface{}) map[string]interface{} {
+	dst := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		dst[k] = v
+	}
+	return dst
+}
+
+// Load implements Store.
+func (s *MemoryStore) Load(id string) (map[string]interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.sessions[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if time.Now().After(entry.expires) {
+		delete(s.sessions, id)
+		return nil, ErrNotFound
+	}
+	return copyValues(entry.values), nil
+}
+
+// Save implements Store.
+func (s *MemoryStore) Save(id string, values map[string]interface{}, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.sessions[id] = memoryEntry{values: copyValues(values), expires: now.Add(ttl)}
+	if now.Sub(s.lastGC) > gcInterval {
+		for id, entry := range s.sessions {
+			if now.After(entry.expires) {
+				delete(s.sessions, id)
+			}
+		}
+		s.lastGC = now
+	}
+	return nil
+}
+
+// Delete implements Store.
+func (s *MemoryStore) Delete(id string) error {
+	s.mu.Lock()
+	delete(s.sessions, id)
+	s.mu.Unlock()
+	return nil
+}
+
+// Len returns the number of sessions held, including expired ones
+// that have not been swept yet.
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sessions)
+}
+
+// FileStore is a Store keeping each session in a gob encoded file.
+type FileStore struct {
+	dir    string
+	mu     sync.Mutex
+	lastGC time.Time
+}
+
+const filePrefix = "lee_session_"
+
+// NewFileStore is the constructor of FileStore, creating dir if needed.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir, lastGC: time.Now()}, nil
+}
+
+func (s *FileStore) path(id string) (string, error) {
+	if !validID(id) {
+		return "", ErrNotFound
+	}
+	return filepath.Join(s.dir, filePrefix+id), nil
+}
+
+// Load implements Store.
+func (s *FileStore) Load(id string) (map[string]interface{}, error) {
+	name, err := s.path(id)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var cs cookieSession
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&cs); err != nil {
+		return nil, err
+	}
+	if time.Now().After(cs.Expires) {
+		os.Remove(name)
+		return nil, ErrNotFound
+	}
+	if cs.Values == nil {
+		cs.Values = make(map[string]interface{})
+	}
+	return cs.Values, nil
+}
+
+// Save implements Store. The file is replaced atomically.
+func (s *FileStore) Save(id string, values map[string]interface{}, ttl time.Duration) error {
+	name, err := s.path(id)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&cookieSession{Expires: time.Now().Add(ttl), Values: values}); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(s.dir, ".tmp_"+filePrefix)
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	s.gc()
+	return nil
+}
+
+// Delete implements Store.
+func (s *FileStore) Delete(id string) error {
+	name, err := s.path(id)
+	if err != nil {
+		return nil
+	}
+	if err := os.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// gc removes expired session files, at most once per gcInterval
+func (s *FileStore) gc() {
+	s.mu.Lock()
+	if time.Since(s.lastGC) < gcInterval {
+		s.mu.Unlock()
+		return
+	}
+	s.lastGC = time.Now()
+	s.mu.Unlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if id, ok := strings.CutPrefix(entry.Name(), filePrefix); ok {
+			// Load removes the file when the session has expired
+			s.Load(id)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package Lee
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/lpz1208/Lee/Lee/render"
+)
+
+// SetSSEKeepAlive sets how often Stream sends a comment to keep idle
+// connections open, 15 seconds by default. Zero disables keep-alives.
+func (engine *Engine) SetSSEKeepAlive(interval time.Duration) {
+	engine.sseKeepAlive = interval
+}
+
+// LastEventID returns the id of the last event a reconnecting
+// EventSource client received.
+func (c *Context) LastEventID() string {
+	return c.Req.Header.Get("Last-Event-ID")
+}
+
+// SSEvent writes a server-sent event and flushes it to the client.
+func (c *Context) SSEvent(name string, data interface{}) error {
+	return c.SSEventWithID("", name, data)
+}
+
+// SSEventWithID writes a server-sent event with an id, which the client
+// sends back as Last-Event-ID when it reconnects.
+func (c *Context) SSEventWithID(id, name string, data interface{}) error {
+	c.streamMu.Lock()
+	defer c.streamMu.Unlock()
+	c.startEventStream()
+	err := render.SSEvent{ID: id, Event: name, Data: data, Codec: c.engine.jsonCodec}.Render(c.Writer)
+	c.Writer.Flush()
+	return err
+}
+
+// startEventStream sends the headers of an event stream
+func (c *Context) startEventStream() {
+	if c.Writer.Written() {
+		return
+	}
+	render.SSEvent{}.WriteContentType(c.Writer)
+	// keep proxies such as nginx from buffering the stream
+	c.SetHeader("X-Accel-Buffering", "no")
+	c.Writer.WriteHeaderNow()
+}
+
+// streamWriter serializes writes of a step with keep-alives
+type streamWriter struct {
+	c *Context
+}
+
+func (w streamWriter) Write(p []byte) (int, error) {
+	w.c.streamMu.Lock()
+	defer w.c.streamMu.Unlock()
+	return w.c.Writer.Write(p)
+}
+
+// Stream sends an event stream, calling step until it returns false or
+// the client goes away, and flushing after every call. While step blocks,
+// keep-alive comments are sent at the engine's interval, so step should
+// also watch c.Req.Context().Done(). Stream reports whether the client
+// disconnected.
+func (c *Context) Stream(step func(w io.Writer) bool) bool {
+	c.streamMu.Lock()
+	c.startEventStream()
+	c.Writer.Flush()
+	c.streamMu.Unlock()
+
+	done := c.Req.Context().Done()
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	if interval := c.engine.sseKeepAlive; interval > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					c.streamMu.Lock()
+					io.WriteString(c.Writer, ": keep-alive\n\n")
+					c.Writer.Flush()
+					c.streamMu.Unlock()
+				case <-stop:
+					return
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+	// the keep-alive goroutine must be gone before the context is reused
+	defer wg.Wait()
+	defer close(stop)
+
+	w := streamWriter{c}
+	for {
+		select {
+		case <-done:
+			return true
+		default:
+		}
+		keepOpen := step(w)
+		c.streamMu.Lock()
+		c.Writer.Flush()
+		c.streamMu.Unlock()
+		if !keepOpen {
+			return false
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package Lee
+
+import (
+	"net/http"
+
+	"github.com/lpz1208/Lee/Lee/websocket"
+)
+
+// Upgrade upgrades the request to a WebSocket connection, which the
+// handler owns from then on. Nothing may be written to the response
+// before. On failure an error response has already been sent.
+func (c *Context) Upgrade(opts *websocket.Options) (*websocket.Conn, error) {
+	conn, err := websocket.Upgrade(c.Writer, c.Req, opts)
+	if err != nil {
+		c.index = len(c.handlers)
+		return nil, err
+	}
+	c.StatusCode = http.StatusSwitchingProtocols
+	c.writermem.status = http.StatusSwitchingProtocols
+	return conn, nil
+}
@@ -0,0 +1,154 @@
+package websocket
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DialOptions configures Dial.
+type DialOptions struct {
+	// Header is sent with the handshake request, for example Origin.
+	Header http.Header
+	// Subprotocols are offered in order of preference.
+	Subprotocols []string
+	// EnableCompression offers permessage-deflate.
+	EnableCompression bool
+	// TLSConfig is used for wss URLs.
+	TLSConfig *tls.Config
+	// ReadLimit is the maximum message size, 16MB by default.
+	ReadLimit int64
+}
+
+// ErrBadHandshake is returned by Dial when the server does not accept
+// the handshake. The response is returned along with it.
+var ErrBadHandshake = errors.New("websocket: bad handshake")
+
+// Dial opens a WebSocket client connection to a ws or wss URL.
+func Dial(ctx context.Context, rawURL string, opts *DialOptions) (*Conn, *http.Response, error) {
+	if opts == nil {
+		opts = &DialOptions{}
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	var secure bool
+	switch u.Scheme {
+	case "ws":
+	case "wss":
+		secure = true
+	default:
+		return nil, nil, errors.New("websocket: URL scheme must be ws or wss")
+	}
+	host := u.Host
+	if u.Port() == "" {
+		if secure {
+			host = net.JoinHostPort(u.Hostname(), "443")
+		} else {
+			host = net.JoinHostPort(u.Hostname(), "80")
+		}
+	}
+
+	var dialer net.Dialer
+	netConn, err := dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, nil, err
+	}
+	// abort the handshake when ctx is done
+	stop := context.AfterFunc(ctx, func() { netConn.Close() })
+	defer stop()
+
+	if secure {
+		cfg := opts.TLSConfig.Clone()
+		if cfg == nil {
+			cfg = &tls.Config{}
+		}
+		if cfg.ServerName == "" {
+			cfg.ServerName = u.Hostname()
+		}
+		tlsConn := tls.Client(netConn, cfg)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			netConn.Close()
+			return nil, nil, err
+		}
+		netConn = tlsConn
+	}
+
+	keyBytes := make([]byte, 16)
+	if _, err := rand.Read(keyBytes); err != nil {
+		netConn.Close()
+		return nil, nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(keyBytes)
+
+	req := &http.Request{
+		Method:     http.MethodGet,
+		URL:        &url.URL{Path: u.Path, RawPath: u.RawPath, RawQuery: u.RawQuery},
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{},
+		Host:       u.Host,
+	}
+	if req.URL.Path == "" {
+		req.URL.Path = "/"
+	}
+	for name, values := range opts.Header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	if len(opts.Subprotocols) > 0 {
+		req.Header.Set("Sec-WebSocket-Protocol", strings.Join(opts.Subprotocols, ", "))
+	}
+	if opts.EnableCompression {
+		req.Header.Set("Sec-WebSocket-Extensions", "permessage-deflate; server_no_context_takeover; client_no_context_takeover")
+	}
+	if err := req.Write(netConn); err != nil {
+		netConn.Close()
+		return nil, nil, err
+	}
+
+	br := bufio.NewReader(netConn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		netConn.Close()
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols ||
+		!headerHasToken(resp.Header, "Upgrade", "websocket") ||
+		!headerHasToken(resp.Header, "Connection", "upgrade") ||
+		resp.Header.Get("Sec-WebSocket-Accept") != computeAccept(key) {
+		netConn.Close()
+		return nil, resp, ErrBadHandshake
+	}
+
+	c := newConn(netConn, br, nil, false)
+	c.subprotocol = resp.Header.Get("Sec-WebSocket-Protocol")
+	for _, ext := range parseExtensions(resp.Header.Values("Sec-WebSocket-Extensions")) {
+		// the server must agree to reset its context for every message
+		if !opts.EnableCompression || ext.name != "permessage-deflate" {
+			netConn.Close()
+			return nil, resp, ErrBadHandshake
+		}
+		if _, ok := ext.params["server_no_context_takeover"]; !ok {
+			netConn.Close()
+			return nil, resp, ErrBadHandshake
+		}
+		c.compress = true
+	}
+	if opts.ReadLimit > 0 {
+		c.readLimit = opts.ReadLimit
+	}
+	return c, resp, nil
+}
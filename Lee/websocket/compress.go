@@ -0,0 +1,121 @@
+package websocket
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"strings"
+	"sync"
+)
+
+const (
+	minCompressionLevel     = flate.HuffmanOnly
+	maxCompressionLevel     = flate.BestCompression
+	defaultCompressionLevel = flate.BestSpeed
+)
+
+// flateWriter remembers its level, so it goes back to the pool it was
+// taken from even if the level of the connection changed meanwhile
+type flateWriter struct {
+	*flate.Writer
+	level int
+}
+
+// flateWriterPools reuse flate writers, one pool per compression level
+var flateWriterPools [maxCompressionLevel - minCompressionLevel + 1]sync.Pool
+
+var flateReaderPool = sync.Pool{New: func() interface{} {
+	return flate.NewReader(nil)
+}}
+
+func getFlateWriter(level int, dst io.Writer) *flateWriter {
+	if fw, ok := flateWriterPools[level-minCompressionLevel].Get().(*flateWriter); ok {
+		fw.Reset(dst)
+		return fw
+	}
+	w, _ := flate.NewWriter(dst, level)
+	return &flateWriter{Writer: w, level: level}
+}
+
+func putFlateWriter(fw *flateWriter) {
+	// drop the reference to the message writer
+	fw.Reset(io.Discard)
+	flateWriterPools[fw.level-minCompressionLevel].Put(fw)
+}
+
+// deflateTail restores the flush marker removed by the sender and adds
+// an empty final block, so the reader ends cleanly
+var deflateTail = []byte{0x00, 0x00, 0xff, 0xff, 0x01, 0x00, 0x00, 0xff, 0xff}
+
+// decompress inflates a message, refusing to produce more than the
+// read limit so small payloads can't expand without bound
+func (c *Conn) decompress(data []byte) ([]byte, error) {
+	fr := flateReaderPool.Get().(io.ReadCloser)
+	defer flateReaderPool.Put(fr)
+	fr.(flate.Resetter).Reset(io.MultiReader(bytes.NewReader(data), bytes.NewReader(deflateTail)), nil)
+
+	out, err := io.ReadAll(io.LimitReader(fr, c.readLimit+1))
+	if err != nil {
+		return nil, &ProtocolError{Code: CloseInvalidFramePayloadData, Reason: "invalid compressed data"}
+	}
+	if int64(len(out)) > c.readLimit {
+		return nil, ErrReadLimit
+	}
+	return out, nil
+}
+
+// extension is one entry of a Sec-WebSocket-Extensions header
+type extension struct {
+	name   string
+	params map[string]string
+}
+
+func parseExtensions(values []string) []extension {
+	var extensions []extension
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			parts := strings.Split(item, ";")
+			ext := extension{name: strings.ToLower(strings.TrimSpace(parts[0])), params: map[string]string{}}
+			if ext.name == "" {
+				continue
+			}
+			for _, param := range parts[1:] {
+				key, val, _ := strings.Cut(strings.TrimSpace(param), "=")
+				key = strings.ToLower(strings.TrimSpace(key))
+				if _, dup := ext.params[key]; dup {
+					// duplicate parameters make the offer invalid
+					ext.name = ""
+					break
+				}
+				ext.params[key] = strings.Trim(strings.TrimSpace(val), `"`)
+			}
+			if ext.name != "" {
+				extensions = append(extensions, ext)
+			}
+		}
+	}
+	return extensions
+}
+
+// acceptDeflate reports whether a permessage-deflate offer can be
+// served without context takeover and with a full window
+func acceptDeflate(ext extension) bool {
+	if ext.name != "permessage-deflate" {
+		return false
+	}
+	for key, val := range ext.params {
+		switch key {
+		case "client_no_context_takeover", "server_no_context_takeover", "client_max_window_bits":
+		case "server_max_window_bits":
+			// compress/flate always uses a 32KB window
+			if val != "15" {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+const deflateResponse = "permessage-deflate; server_no_context_takeover; client_no_context_takeover"
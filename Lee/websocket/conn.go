@@ -0,0 +1,633 @@
+// Package websocket implements the WebSocket protocol of RFC 6455,
+// including the permessage-deflate extension of RFC 7692.
+//
+// Servers obtain a Conn from Upgrade, or from Context.Upgrade in Lee,
+// clients from Dial. A Conn supports one concurrent reader and one
+// concurrent writer of data messages; WriteControl may be called from
+// any goroutine.
+package websocket
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Message types, which are the opcodes of their frames.
+const (
+	TextMessage   = 1
+	BinaryMessage = 2
+	CloseMessage  = 8
+	PingMessage   = 9
+	PongMessage   = 10
+)
+
+// Close codes defined in RFC 6455 section 7.4.1 and the IANA registry.
+const (
+	CloseNormalClosure           = 1000
+	CloseGoingAway               = 1001
+	CloseProtocolError           = 1002
+	CloseUnsupportedData         = 1003
+	CloseNoStatusReceived        = 1005
+	CloseAbnormalClosure         = 1006
+	CloseInvalidFramePayloadData = 1007
+	ClosePolicyViolation         = 1008
+	CloseMessageTooBig           = 1009
+	CloseMandatoryExtension      = 1010
+	CloseInternalServerErr       = 1011
+	CloseServiceRestart          = 1012
+	CloseTryAgainLater           = 1013
+	CloseTLSHandshake            = 1015
+)
+
+const (
+	continuationFrame = 0
+
+	finalBit = 1 << 7
+	rsv1Bit  = 1 << 6
+	rsv2Bit  = 1 << 5
+	rsv3Bit  = 1 << 4
+	maskBit  = 1 << 7
+
+	maxControlPayload = 125
+
+	defaultReadLimit       = 16 << 20
+	defaultWriteBufferSize = 4096
+
+	// how long a failing connection waits to send its close frame
+	closeWriteWait = time.Second
+)
+
+// ErrCloseSent is returned when writing after a close frame was sent.
+var ErrCloseSent = errors.New("websocket: close sent")
+
+// CloseError is returned by ReadMessage when the peer closed the
+// connection with a close frame. Code is CloseNoStatusReceived if the
+// frame had no status code.
+type CloseError struct {
+	Code int
+	Text string
+}
+
+func (e *CloseError) Error() string {
+	if e.Text == "" {
+		return fmt.Sprintf("websocket: close %d", e.Code)
+	}
+	return fmt.Sprintf("websocket: close %d: %s", e.Code, e.Text)
+}
+
+// ProtocolError is returned by ReadMessage when the peer broke the
+// protocol. The connection has been closed with Code.
+type ProtocolError struct {
+	Code   int
+	Reason string
+}
+
+func (e *ProtocolError) Error() string {
+	return "websocket: " + e.Reason
+}
+
+// ErrReadLimit is returned when a message is larger than the read limit.
+var ErrReadLimit = &ProtocolError{Code: CloseMessageTooBig, Reason: "read limit exceeded"}
+
+func protocolError(reason string) error {
+	return &ProtocolError{Code: CloseProtocolError, Reason: reason}
+}
+
+// Conn is a WebSocket connection.
+type Conn struct {
+	conn        net.Conn
+	br          *bufio.Reader
+	bw          *bufio.Writer
+	isServer    bool
+	subprotocol string
+
+	// permessage-deflate, always without context takeover
+	compress         bool
+	compressionLevel int
+
+	writeMu         sync.Mutex
+	closeSent       bool
+	writeBufferSize int
+
+	readLimit   int64
+	readErr     error
+	pingHandler func(data string) error
+	pongHandler func(data string) error
+}
+
+func newConn(conn net.Conn, br *bufio.Reader, bw *bufio.Writer, isServer bool) *Conn {
+	if br == nil {
+		br = bufio.NewReader(conn)
+	}
+	if bw == nil {
+		bw = bufio.NewWriter(conn)
+	}
+	return &Conn{
+		conn:             conn,
+		br:               br,
+		bw:               bw,
+		isServer:         isServer,
+		compressionLevel: defaultCompressionLevel,
+		writeBufferSize:  defaultWriteBufferSize,
+		readLimit:        defaultReadLimit,
+	}
+}
+
+// Subprotocol returns the negotiated subprotocol.
+func (c *Conn) Subprotocol() string {
+	return c.subprotocol
+}
+
+// Compressed reports whether permessage-deflate was negotiated.
+func (c *Conn) Compressed() bool {
+	return c.compress
+}
+
+// NetConn returns the underlying connection.
+func (c *Conn) NetConn() net.Conn {
+	return c.conn
+}
+
+// LocalAddr returns the local network address.
+func (c *Conn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+// RemoteAddr returns the remote network address.
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// SetReadLimit sets the maximum size of a message read from the peer,
+// after decompression. Larger messages close the connection with
+// CloseMessageTooBig.
+func (c *Conn) SetReadLimit(limit int64) {
+	c.readLimit = limit
+}
+
+// SetReadDeadline sets the deadline for reads on the connection.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the deadline for writes on the connection.
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
+
+// SetCompressionLevel sets the flate level of compressed messages.
+func (c *Conn) SetCompressionLevel(level int) error {
+	if level < minCompressionLevel || level > maxCompressionLevel {
+		return errors.New("websocket: invalid compression level")
+	}
+	c.compressionLevel = level
+	return nil
+}
+
+// SetPingHandler sets the function called for ping frames received while
+// reading. The default handler replies with a pong.
+func (c *Conn) SetPingHandler(h func(data string) error) {
+	c.pingHandler = h
+}
+
+// SetPongHandler sets the function called for pong frames received
+// while reading.
+func (c *Conn) SetPongHandler(h func(data string) error) {
+	c.pongHandler = h
+}
+
+// Close closes the underlying connection without a close handshake.
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+// FormatCloseMessage returns the payload of a close frame.
+func FormatCloseMessage(code int, text string) []byte {
+	if code == CloseNoStatusReceived {
+		return []byte{}
+	}
+	buf := make([]byte, 2+len(text))
+	binary.BigEndian.PutUint16(buf, uint16(code))
+	copy(buf[2:], text)
+	return buf
+}
+
+// validCloseCode reports whether code may be sent in a close frame
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003:
+		return true
+	case code >= 1007 && code <= 1014:
+		return true
+	case code >= 3000 && code <= 4999:
+		return true
+	}
+	return false
+}
+
+// WriteClose starts the close handshake. The peer's close frame is
+// returned as a CloseError by the next ReadMessage.
+func (c *Conn) WriteClose(code int, text string) error {
+	return c.WriteControl(CloseMessage, FormatCloseMessage(code, text))
+}
+
+// WriteControl writes a close, ping or pong frame.
+func (c *Conn) WriteControl(messageType int, data []byte) error {
+	if messageType != CloseMessage && messageType != PingMessage && messageType != PongMessage {
+		return errors.New("websocket: bad control message type")
+	}
+	if len(data) > maxControlPayload {
+		return errors.New("websocket: control frame payload too large")
+	}
+	return c.writeFrame(true, false, messageType, data)
+}
+
+// WriteMessage writes a complete message.
+func (c *Conn) WriteMessage(messageType int, data []byte) error {
+	if messageType >= CloseMessage {
+		return c.WriteControl(messageType, data)
+	}
+	w, err := c.NextWriter(messageType)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+func maskBytes(key [4]byte, pos int, b []byte) {
+	for i := range b {
+		b[i] ^= key[(pos+i)&3]
+	}
+}
+
+func (c *Conn) writeFrame(fin, rsv1 bool, opcode int, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closeSent {
+		return ErrCloseSent
+	}
+
+	var header [14]byte
+	header[0] = byte(opcode)
+	if fin {
+		header[0] |= finalBit
+	}
+	if rsv1 {
+		header[0] |= rsv1Bit
+	}
+	n := 2
+	switch length := len(payload); {
+	case length <= 125:
+		header[1] = byte(length)
+	case length <= 0xFFFF:
+		header[1] = 126
+		binary.BigEndian.PutUint16(header[2:], uint16(length))
+		n = 4
+	default:
+		header[1] = 127
+		binary.BigEndian.PutUint64(header[2:], uint64(length))
+		n = 10
+	}
+	if !c.isServer {
+		// clients mask every frame with a fresh random key
+		var key [4]byte
+		if _, err := rand.Read(key[:]); err != nil {
+			return err
+		}
+		header[1] |= maskBit
+		copy(header[n:], key[:])
+		n += 4
+		masked := make([]byte, len(payload))
+		copy(masked, payload)
+		maskBytes(key, 0, masked)
+		payload = masked
+	}
+	if opcode == CloseMessage {
+		c.closeSent = true
+	}
+
+	if _, err := c.bw.Write(header[:n]); err != nil {
+		return err
+	}
+	if _, err := c.bw.Write(payload); err != nil {
+		return err
+	}
+	return c.bw.Flush()
+}
+
+// NextWriter returns a writer for the next text or binary message. The
+// message is sent in frames of the write buffer size and is complete
+// when the writer is closed.
+func (c *Conn) NextWriter(messageType int) (io.WriteCloser, error) {
+	if messageType != TextMessage && messageType != BinaryMessage {
+		return nil, errors.New("websocket: bad data message type")
+	}
+	w := &messageWriter{c: c, opcode: messageType, compress: c.compress, first: true}
+	if w.compress {
+		w.fw = getFlateWriter(c.compressionLevel, (*compressSink)(w))
+	}
+	return w, nil
+}
+
+type messageWriter struct {
+	c        *Conn
+	opcode   int
+	compress bool
+	first    bool
+	buf      []byte
+	fw       *flateWriter
+	closed   bool
+	err      error
+}
+
+// compressSink receives the output of the flate writer
+type compressSink messageWriter
+
+func (s *compressSink) Write(p []byte) (int, error) {
+	w := (*messageWriter)(s)
+	return len(p), w.appendFrameData(p)
+}
+
+func (w *messageWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("websocket: write to closed message writer")
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+	if w.compress {
+		if _, err := w.fw.Write(p); err != nil {
+			w.err = err
+			return 0, err
+		}
+		return len(p), w.err
+	}
+	if err := w.appendFrameData(p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// appendFrameData buffers payload and sends full frames. Compressed
+// messages hold back four bytes, the flush marker which is removed
+// from the end of the message.
+func (w *messageWriter) appendFrameData(p []byte) error {
+	w.buf = append(w.buf, p...)
+	holdback := 0
+	if w.compress {
+		holdback = 4
+	}
+	size := w.c.writeBufferSize
+	for len(w.buf) > size+holdback {
+		if err := w.flushFrame(false, w.buf[:size]); err != nil {
+			return err
+		}
+		w.buf = append(w.buf[:0], w.buf[size:]...)
+	}
+	return nil
+}
+
+func (w *messageWriter) flushFrame(fin bool, payload []byte) error {
+	err := w.c.writeFrame(fin, w.compress && w.first, w.opcode, payload)
+	w.opcode = continuationFrame
+	w.first = false
+	if err != nil {
+		w.err = err
+	}
+	return err
+}
+
+func (w *messageWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if w.compress {
+		err := w.fw.Flush()
+		putFlateWriter(w.fw)
+		w.fw = nil
+		if err != nil {
+			return err
+		}
+		if w.err != nil {
+			return w.err
+		}
+		w.buf = w.buf[:len(w.buf)-4]
+	}
+	if w.err != nil {
+		return w.err
+	}
+	return w.flushFrame(true, w.buf)
+}
+
+// frameHeader holds the fields of a frame that matter after parsing
+type frameHeader struct {
+	fin    bool
+	rsv1   bool
+	opcode int
+}
+
+// readFrame reads one frame, checking it against RFC 6455. read is the
+// size of the message read so far, used to enforce the read limit.
+func (c *Conn) readFrame(read int64) (frameHeader, []byte, error) {
+	var b [8]byte
+	if _, err := io.ReadFull(c.br, b[:2]); err != nil {
+		return frameHeader{}, nil, err
+	}
+	h := frameHeader{
+		fin:    b[0]&finalBit != 0,
+		rsv1:   b[0]&rsv1Bit != 0,
+		opcode: int(b[0] & 0xf),
+	}
+	if b[0]&(rsv2Bit|rsv3Bit) != 0 {
+		return h, nil, protocolError("reserved bits set")
+	}
+	switch h.opcode {
+	case continuationFrame, TextMessage, BinaryMessage:
+		if h.rsv1 && (!c.compress || h.opcode == continuationFrame) {
+			return h, nil, protocolError("unexpected RSV1 bit")
+		}
+	case CloseMessage, PingMessage, PongMessage:
+		if h.rsv1 {
+			return h, nil, protocolError("RSV1 bit set on control frame")
+		}
+		if !h.fin {
+			return h, nil, protocolError("fragmented control frame")
+		}
+	default:
+		return h, nil, protocolError(fmt.Sprintf("unknown opcode %d", h.opcode))
+	}
+
+	masked := b[1]&maskBit != 0
+	if masked != c.isServer {
+		if c.isServer {
+			return h, nil, protocolError("client frame not masked")
+		}
+		return h, nil, protocolError("server frame masked")
+	}
+
+	length := int64(b[1] & 0x7f)
+	switch length {
+	case 126:
+		if _, err := io.ReadFull(c.br, b[:2]); err != nil {
+			return h, nil, err
+		}
+		length = int64(binary.BigEndian.Uint16(b[:2]))
+	case 127:
+		if _, err := io.ReadFull(c.br, b[:8]); err != nil {
+			return h, nil, err
+		}
+		u := binary.BigEndian.Uint64(b[:8])
+		if u>>63 != 0 {
+			return h, nil, protocolError("invalid frame length")
+		}
+		length = int64(u)
+	}
+	if h.opcode >= CloseMessage && length > maxControlPayload {
+		return h, nil, protocolError("control frame payload too large")
+	}
+	if h.opcode < CloseMessage && read+length > c.readLimit {
+		return h, nil, ErrReadLimit
+	}
+
+	var key [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.br, key[:]); err != nil {
+			return h, nil, err
+		}
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return h, nil, err
+	}
+	if masked {
+		maskBytes(key, 0, payload)
+	}
+	return h, payload, nil
+}
+
+// ReadMessage reads the next text or binary message, answering control
+// frames on the way. Once it fails, every later call returns the same
+// error.
+func (c *Conn) ReadMessage() (messageType int, p []byte, err error) {
+	if c.readErr != nil {
+		return 0, nil, c.readErr
+	}
+	messageType, p, err = c.readMessage()
+	if err != nil {
+		c.readErr = err
+	}
+	return messageType, p, err
+}
+
+func (c *Conn) readMessage() (int, []byte, error) {
+	var (
+		messageType int
+		compressed  bool
+		message     []byte
+	)
+	for {
+		h, payload, err := c.readFrame(int64(len(message)))
+		if err != nil {
+			return 0, nil, c.fail(err)
+		}
+		if h.opcode >= CloseMessage {
+			if err := c.handleControl(h.opcode, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		}
+
+		if h.opcode == continuationFrame {
+			if messageType == 0 {
+				return 0, nil, c.fail(protocolError("continuation frame without a message"))
+			}
+		} else {
+			if messageType != 0 {
+				return 0, nil, c.fail(protocolError("new message inside a fragmented message"))
+			}
+			messageType, compressed = h.opcode, h.rsv1
+		}
+		message = append(message, payload...)
+		if !h.fin {
+			continue
+		}
+
+		if compressed {
+			if message, err = c.decompress(message); err != nil {
+				return 0, nil, c.fail(err)
+			}
+		}
+		if messageType == TextMessage && !utf8.Valid(message) {
+			return 0, nil, c.fail(&ProtocolError{Code: CloseInvalidFramePayloadData, Reason: "invalid UTF-8 in text message"})
+		}
+		if message == nil {
+			message = []byte{}
+		}
+		return messageType, message, nil
+	}
+}
+
+func (c *Conn) handleControl(opcode int, payload []byte) error {
+	switch opcode {
+	case PingMessage:
+		if c.pingHandler != nil {
+			return c.pingHandler(string(payload))
+		}
+		if err := c.WriteControl(PongMessage, payload); err != nil && err != ErrCloseSent {
+			return c.fail(err)
+		}
+	case PongMessage:
+		if c.pongHandler != nil {
+			return c.pongHandler(string(payload))
+		}
+	case CloseMessage:
+		closeErr := &CloseError{Code: CloseNoStatusReceived}
+		switch {
+		case len(payload) == 1:
+			return c.fail(protocolError("invalid close frame payload"))
+		case len(payload) >= 2:
+			closeErr.Code = int(binary.BigEndian.Uint16(payload))
+			if !validCloseCode(closeErr.Code) {
+				return c.fail(protocolError(fmt.Sprintf("invalid close code %d", closeErr.Code)))
+			}
+			if !utf8.Valid(payload[2:]) {
+				return c.fail(&ProtocolError{Code: CloseInvalidFramePayloadData, Reason: "invalid UTF-8 in close reason"})
+			}
+			closeErr.Text = string(payload[2:])
+		}
+		// echo the status code, unless we started the handshake
+		c.conn.SetWriteDeadline(time.Now().Add(closeWriteWait))
+		c.WriteControl(CloseMessage, FormatCloseMessage(closeErr.Code, ""))
+		c.conn.Close()
+		return closeErr
+	}
+	return nil
+}
+
+// fail closes the connection, with a close frame for protocol errors
+func (c *Conn) fail(err error) error {
+	var pe *ProtocolError
+	if errors.As(err, &pe) {
+		reason := pe.Reason
+		if len(reason) > maxControlPayload-2 {
+			reason = reason[:maxControlPayload-2]
+		}
+		c.conn.SetWriteDeadline(time.Now().Add(closeWriteWait))
+		c.WriteControl(CloseMessage, FormatCloseMessage(pe.Code, reason))
+	}
+	c.conn.Close()
+	return err
+}
@@ -0,0 +1,193 @@
+package websocket
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// acceptGUID is appended to the client key to compute Sec-WebSocket-Accept
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// Options configures Upgrade.
+type Options struct {
+	// Subprotocols lists the supported subprotocols in order of preference.
+	Subprotocols []string
+	// CheckOrigin decides whether the Origin of the request is allowed.
+	// By default only requests without Origin or from the same host are.
+	CheckOrigin func(r *http.Request) bool
+	// EnableCompression negotiates permessage-deflate when the client
+	// offers it.
+	EnableCompression bool
+	// ReadLimit is the maximum message size, 16MB by default.
+	ReadLimit int64
+	// WriteBufferSize is the frame size of written messages, 4KB by default.
+	WriteBufferSize int
+	// HandshakeTimeout limits the time to write the handshake response.
+	HandshakeTimeout time.Duration
+}
+
+// HandshakeError is returned by Upgrade when the request is not a valid
+// WebSocket handshake. An error response has been written.
+type HandshakeError struct {
+	Status int
+	Reason string
+}
+
+func (e *HandshakeError) Error() string {
+	return "websocket: " + e.Reason
+}
+
+func computeAccept(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key))
+	h.Write([]byte(acceptGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// headerHasToken reports whether a comma separated header contains token
+func headerHasToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, item := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(item), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sameOrigin is the default CheckOrigin
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+func selectSubprotocol(r *http.Request, supported []string) string {
+	var offered []string
+	for _, value := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, p := range strings.Split(value, ",") {
+			offered = append(offered, strings.TrimSpace(p))
+		}
+	}
+	for _, s := range supported {
+		for _, o := range offered {
+			if s == o {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+func handshakeError(w http.ResponseWriter, status int, reason string) error {
+	if status == http.StatusUpgradeRequired {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+	}
+	http.Error(w, http.StatusText(status), status)
+	return &HandshakeError{Status: status, Reason: reason}
+}
+
+// Upgrade completes the WebSocket handshake of r and takes over the
+// connection. Headers already set on w, such as cookies, are sent with
+// the handshake response. On failure an HTTP error is written.
+func Upgrade(w http.ResponseWriter, r *http.Request, opts *Options) (*Conn, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	if r.Method != http.MethodGet {
+		return nil, handshakeError(w, http.StatusMethodNotAllowed, "handshake method is not GET")
+	}
+	if !headerHasToken(r.Header, "Connection", "upgrade") || !headerHasToken(r.Header, "Upgrade", "websocket") {
+		return nil, handshakeError(w, http.StatusBadRequest, "not a websocket handshake")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		return nil, handshakeError(w, http.StatusUpgradeRequired, "unsupported version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		return nil, handshakeError(w, http.StatusBadRequest, "invalid Sec-WebSocket-Key")
+	}
+	checkOrigin := opts.CheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = sameOrigin
+	}
+	if !checkOrigin(r) {
+		return nil, handshakeError(w, http.StatusForbidden, "origin not allowed")
+	}
+
+	subprotocol := selectSubprotocol(r, opts.Subprotocols)
+	compress := false
+	if opts.EnableCompression {
+		for _, ext := range parseExtensions(r.Header.Values("Sec-WebSocket-Extensions")) {
+			if acceptDeflate(ext) {
+				compress = true
+				break
+			}
+		}
+	}
+
+	netConn, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return nil, handshakeError(w, http.StatusInternalServerError, "connection can't be hijacked: "+err.Error())
+	}
+	if brw.Reader.Buffered() > 0 {
+		netConn.Close()
+		return nil, errors.New("websocket: client sent data before the handshake completed")
+	}
+
+	var resp strings.Builder
+	resp.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+	resp.WriteString("Sec-WebSocket-Accept: " + computeAccept(key) + "\r\n")
+	if subprotocol != "" {
+		resp.WriteString("Sec-WebSocket-Protocol: " + subprotocol + "\r\n")
+	}
+	if compress {
+		resp.WriteString("Sec-WebSocket-Extensions: " + deflateResponse + "\r\n")
+	}
+	for name, values := range w.Header() {
+		switch http.CanonicalHeaderKey(name) {
+		case "Upgrade", "Connection", "Sec-Websocket-Accept", "Sec-Websocket-Protocol", "Sec-Websocket-Extensions":
+			continue
+		}
+		for _, value := range values {
+			resp.WriteString(name + ": " + value + "\r\n")
+		}
+	}
+	resp.WriteString("\r\n")
+
+	// the server may have set deadlines for the HTTP request
+	netConn.SetDeadline(time.Time{})
+	if opts.HandshakeTimeout > 0 {
+		netConn.SetWriteDeadline(time.Now().Add(opts.HandshakeTimeout))
+	}
+	if _, err := netConn.Write([]byte(resp.String())); err != nil {
+		netConn.Close()
+		return nil, err
+	}
+	if opts.HandshakeTimeout > 0 {
+		netConn.SetWriteDeadline(time.Time{})
+	}
+
+	c := newConn(netConn, brw.Reader, brw.Writer, true)
+	c.subprotocol = subprotocol
+	c.compress = compress
+	if opts.ReadLimit > 0 {
+		c.readLimit = opts.ReadLimit
+	}
+	if opts.WriteBufferSize > 0 {
+		c.writeBufferSize = opts.WriteBufferSize
+	}
+	return c, nil
+}
@@ -0,0 +1,305 @@
+package websocket
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"encoding/binary"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// newEchoServer starts a server echoing every message, in the spirit
+// of the Autobahn test suite
+func newEchoServer(t *testing.T, opts *Options) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := Upgrade(w, r, opts)
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		for {
+			messageType, message, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err := c.WriteMessage(messageType, message); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+func dial(t *testing.T, url string, opts *DialOptions) *Conn {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, _, err := Dial(ctx, url, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// rawFrame builds a masked client frame with any header byte
+func rawFrame(b0 byte, payload []byte) []byte {
+	frame := []byte{b0, 0}
+	switch {
+	case len(payload) <= 125:
+		frame[1] = byte(len(payload))
+	case len(payload) <= 0xFFFF:
+		frame[1] = 126
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	default:
+		frame[1] = 127
+		frame = binary.BigEndian.AppendUint64(frame, uint64(len(payload)))
+	}
+	frame[1] |= maskBit
+	key := [4]byte{1, 2, 3, 4}
+	frame = append(frame, key[:]...)
+	masked := append([]byte(nil), payload...)
+	maskBytes(key, 0, masked)
+	return append(frame, masked...)
+}
+
+func expectClose(t *testing.T, c *Conn, code int) {
+	t.Helper()
+	for {
+		_, _, err := c.ReadMessage()
+		if err == nil {
+			continue
+		}
+		var closeErr *CloseError
+		if !errors.As(err, &closeErr) {
+			t.Fatalf("expected close %d, got %v", code, err)
+		}
+		if closeErr.Code != code {
+			t.Fatalf("expected close %d, got %d (%s)", code, closeErr.Code, closeErr.Text)
+		}
+		return
+	}
+}
+
+// utf8Message returns size bytes of valid UTF-8 made of one and
+// two-byte runes, so frame and fragment boundaries fall inside them
+func utf8Message(size int) []byte {
+	message := bytes.Repeat([]byte("Lé"), size/3+1)[:size]
+	for !utf8.Valid(message) {
+		message = message[:len(message)-1]
+	}
+	return append(message, strings.Repeat("a", size-len(message))...)
+}
+
+func TestEcho(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		url := newEchoServer(t, &Options{EnableCompression: compress})
+		c := dial(t, url, &DialOptions{EnableCompression: compress})
+		if c.Compressed() != compress {
+			t.Fatalf("compression negotiated: %v, want %v", c.Compressed(), compress)
+		}
+		for _, size := range []int{0, 1, 125, 126, 4096, 65535, 65536, 1 << 20} {
+			for _, messageType := range []int{TextMessage, BinaryMessage} {
+				message := utf8Message(size)
+				if err := c.WriteMessage(messageType, message); err != nil {
+					t.Fatal(err)
+				}
+				gotType, got, err := c.ReadMessage()
+				if err != nil {
+					t.Fatalf("compress %v, size %d: %v", compress, size, err)
+				}
+				if gotType != messageType || !bytes.Equal(got, message) {
+					t.Fatalf("compress %v, size %d: echo mismatch", compress, size)
+				}
+			}
+		}
+	}
+}
+
+func TestCompressionLevelChange(t *testing.T) {
+	c := dial(t, newEchoServer(t, &Options{EnableCompression: true}), &DialOptions{EnableCompression: true})
+	w, err := c.NextWriter(TextMessage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("hello"))
+	// the writer taken at the default level must not end up in the
+	// pool of the new level
+	c.SetCompressionLevel(flate.BestCompression)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if fw, ok := flateWriterPools[flate.BestCompression-minCompressionLevel].Get().(*flateWriter); ok && fw.level != flate.BestCompression {
+		t.Fatalf("writer of level %d in the pool of level %d", fw.level, flate.BestCompression)
+	}
+	if _, got, err := c.ReadMessage(); err != nil || string(got) != "hello" {
+		t.Fatalf("echo: %q %v", got, err)
+	}
+}
+
+func TestFragmentationAndControlFrames(t *testing.T) {
+	c := dial(t, newEchoServer(t, nil), nil)
+	pongs := make(chan string, 1)
+	c.SetPongHandler(func(data string) error {
+		pongs <- data
+		return nil
+	})
+
+	// "Hello wörld" split inside the two bytes of ö, with a ping in between
+	word := []byte("wörld")
+	frames := [][]byte{
+		rawFrame(TextMessage, []byte("Hel")),
+		rawFrame(finalBit|PingMessage, []byte("ping")),
+		rawFrame(continuationFrame, append([]byte("lo "), word[:2]...)),
+		rawFrame(finalBit|continuationFrame, word[2:]),
+	}
+	for _, frame := range frames {
+		if _, err := c.conn.Write(frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+	messageType, message, err := c.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if messageType != TextMessage || string(message) != "Hello wörld" {
+		t.Fatalf("unexpected message %d %q", messageType, message)
+	}
+	if pong := <-pongs; pong != "ping" {
+		t.Fatalf("unexpected pong %q", pong)
+	}
+
+	// large messages are fragmented by the writer
+	c.writeBufferSize = 100
+	big := bytes.Repeat([]byte("x"), 1000)
+	if err := c.WriteMessage(BinaryMessage, big); err != nil {
+		t.Fatal(err)
+	}
+	if _, message, err := c.ReadMessage(); err != nil || !bytes.Equal(message, big) {
+		t.Fatalf("fragmented echo failed: %v", err)
+	}
+}
+
+func TestProtocolViolations(t *testing.T) {
+	tests := []struct {
+		name   string
+		frames [][]byte
+		code   int
+	}{
+		{"reserved bits", [][]byte{rawFrame(finalBit|rsv2Bit|TextMessage, []byte("a"))}, CloseProtocolError},
+		{"rsv1 without compression", [][]byte{rawFrame(finalBit|rsv1Bit|TextMessage, []byte("a"))}, CloseProtocolError},
+		{"reserved data opcode", [][]byte{rawFrame(finalBit|3, nil)}, CloseProtocolError},
+		{"reserved control opcode", [][]byte{rawFrame(finalBit|11, nil)}, CloseProtocolError},
+		{"unmasked frame", [][]byte{{finalBit | TextMessage, 1, 'a'}}, CloseProtocolError},
+		{"ping too large", [][]byte{rawFrame(finalBit|PingMessage, make([]byte, 126))}, CloseProtocolError},
+		{"fragmented ping", [][]byte{rawFrame(PingMessage, nil)}, CloseProtocolError},
+		{"continuation without start", [][]byte{rawFrame(finalBit|continuationFrame, []byte("a"))}, CloseProtocolError},
+		{"message inside fragmented message", [][]byte{
+			rawFrame(TextMessage, []byte("a")),
+			rawFrame(finalBit|TextMessage, []byte("b")),
+		}, CloseProtocolError},
+		{"invalid utf8", [][]byte{rawFrame(finalBit|TextMessage, []byte{0xce, 0xba, 0xff})}, CloseInvalidFramePayloadData},
+		{"truncated utf8", [][]byte{
+			rawFrame(TextMessage, []byte("a")),
+			rawFrame(finalBit|continuationFrame, []byte{0xe2, 0x82}),
+		}, CloseInvalidFramePayloadData},
+		{"close with one byte", [][]byte{rawFrame(finalBit|CloseMessage, []byte{3})}, CloseProtocolError},
+		{"close code 999", [][]byte{rawFrame(finalBit|CloseMessage, FormatCloseMessage(999, ""))}, CloseProtocolError},
+		{"close code 1005", [][]byte{rawFrame(finalBit|CloseMessage, []byte{0x03, 0xed})}, CloseProtocolError},
+		{"close reason invalid utf8", [][]byte{rawFrame(finalBit|CloseMessage, append(FormatCloseMessage(1000, ""), 0xff))}, CloseInvalidFramePayloadData},
+		{"message too big", [][]byte{rawFrame(finalBit|BinaryMessage, make([]byte, 2048))}, CloseMessageTooBig},
+	}
+	url := newEchoServer(t, &Options{ReadLimit: 1024})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := dial(t, url, nil)
+			for _, frame := range tt.frames {
+				if _, err := c.conn.Write(frame); err != nil {
+					t.Fatal(err)
+				}
+			}
+			expectClose(t, c, tt.code)
+		})
+	}
+}
+
+func TestCompressedReadLimit(t *testing.T) {
+	url := newEchoServer(t, &Options{EnableCompression: true, ReadLimit: 1024})
+	c := dial(t, url, &DialOptions{EnableCompression: true})
+	// a megabyte of zeros compresses to a few bytes
+	if err := c.WriteMessage(BinaryMessage, make([]byte, 1<<20)); err != nil {
+		t.Fatal(err)
+	}
+	expectClose(t, c, CloseMessageTooBig)
+}
+
+func TestCloseHandshake(t *testing.T) {
+	serverErr := make(chan error, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := Upgrade(w, r, nil)
+		if err != nil {
+			serverErr <- err
+			return
+		}
+		_, _, err = c.ReadMessage()
+		serverErr <- err
+	}))
+	defer srv.Close()
+
+	c := dial(t, "ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err := c.WriteClose(CloseGoingAway, "bye"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.WriteMessage(TextMessage, []byte("late")); err != ErrCloseSent {
+		t.Fatalf("write after close: %v", err)
+	}
+	expectClose(t, c, CloseGoingAway)
+
+	var closeErr *CloseError
+	if err := <-serverErr; !errors.As(err, &closeErr) || closeErr.Code != CloseGoingAway || closeErr.Text != "bye" {
+		t.Fatalf("server saw %v", err)
+	}
+}
+
+func TestHandshake(t *testing.T) {
+	url := newEchoServer(t, &Options{Subprotocols: []string{"v2", "v1"}})
+
+	c := dial(t, url, &DialOptions{Subprotocols: []string{"v1", "v2"}})
+	if c.Subprotocol() != "v2" {
+		t.Fatalf("subprotocol %q", c.Subprotocol())
+	}
+
+	_, resp, err := Dial(context.Background(), url, &DialOptions{
+		Header: http.Header{"Origin": {"http://evil.example"}},
+	})
+	if err != ErrBadHandshake || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("cross origin handshake: %v", err)
+	}
+
+	req, _ := http.NewRequest("GET", "http"+strings.TrimPrefix(url, "ws"), nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "8")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUpgradeRequired || resp.Header.Get("Sec-WebSocket-Version") != "13" {
+		t.Fatalf("unsupported version: %d", resp.StatusCode)
+	}
+
+	if got := computeAccept("dGhlIHNhbXBsZSBub25jZQ=="); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("accept key %q", got)
+	}
+}